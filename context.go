@@ -4,9 +4,56 @@ import (
 	"net/http"
 )
 
+// Context is reused after request is handled, do not keep it or its Params after handler returns.
+// Param is a new map for each request, it could be kept.
 type Context struct {
 	Rsp   http.ResponseWriter
 	Req   *http.Request
 	Param map[string]string
 	Udata map[string]interface{}
+
+	// Params are the same params as Param, in the order of route pattern
+	Params Params
+
+	router *Router
+	// route serving the request
+	route *RouteNode
+}
+
+func (c *Context) reset(w http.ResponseWriter, req *http.Request, r *Router) {
+	c.Rsp = w
+	c.Req = req
+	c.Udata = nil
+	c.Params = c.Params[:0]
+	c.Param = nil
+	c.router = r
+	c.route = nil
+}
+
+// Route returns the route serving the request, its metadata could be read by Route().Meta(key).
+// it is nil in error handlers if no route is matched.
+func (c *Context) Route() *RouteNode {
+	return c.route
+}
+
+// setParams fills Param with Params, Param map is not reused, so handlers could keep it
+func (c *Context) setParams() {
+	if len(c.Params) == 0 {
+		return
+	}
+	c.Param = make(map[string]string, len(c.Params))
+	for _, p := range c.Params {
+		c.Param[p.Key] = p.Value
+	}
+}
+
+// URL generates url of the named route, see Router.URL
+func (c *Context) URL(name string, params ...string) string {
+	return c.router.URL(name, params...)
+}
+
+// RedirectToRoute replies to the request with a redirect to the named route.
+// params are pairs of param name and value, see Router.URL
+func (c *Context) RedirectToRoute(code int, name string, params ...string) {
+	http.Redirect(c.Rsp, c.Req, c.router.URL(name, params...), code)
 }
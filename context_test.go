@@ -118,3 +118,37 @@ func TestContextUdata(t *testing.T) {
 		t.Fatalf("Context.Udata error, exec_count: %d, udata_error_count: %d", exec_count, udata_error_count)
 	}
 }
+
+func TestContextRedirectToRoute(t *testing.T) {
+	r := newRouter()
+	r.GET("/user/:id", func(*Context) {}).Name("user.show")
+	r.GET("/me", func(c *Context) {
+		c.RedirectToRoute(http.StatusFound, "user.show", "id", "42")
+	})
+
+	rsp := &MockResponseWriter{header: http.Header{}}
+	req, _ := http.NewRequest("GET", "http://localhost/me", nil)
+	r.ServeHTTP(rsp, req)
+
+	if rsp.code != http.StatusFound || rsp.header.Get("Location") != "/user/42" {
+		t.Fatalf("Context.RedirectToRoute error, code: %d, location: %s", rsp.code, rsp.header.Get("Location"))
+	}
+}
+
+func TestContextParamKept(t *testing.T) {
+	var kept []map[string]string
+
+	r := newRouter()
+	r.GET("/user/:id", func(c *Context) {
+		kept = append(kept, c.Param)
+	})
+
+	for _, id := range []string{"1", "2"} {
+		req, _ := http.NewRequest("GET", "http://localhost/user/"+id, nil)
+		r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+	}
+
+	if kept[0]["id"] != "1" || kept[1]["id"] != "2" {
+		t.Fatalf("Param kept by handler should not be changed by the next request, got: %v", kept)
+	}
+}
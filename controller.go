@@ -2,6 +2,7 @@ package iafon
 
 import (
 	"reflect"
+	"sync"
 )
 
 type ControllerInterface interface {
@@ -10,6 +11,8 @@ type ControllerInterface interface {
 	Finalize()
 }
 
+// custom controller should embed base Controller, it is registered by Router.RegisterController.
+// each request gets a copy of the controller registered, the copy is reused after request like Context.
 type Controller struct {
 	*Context
 }
@@ -22,9 +25,16 @@ func (c *Controller) Initialize() {}
 
 func (c *Controller) Finalize() {}
 
-var registeredControllers = make(map[string]*reflect.Value)
+var (
+	registeredControllers   = make(map[string]*reflect.Value)
+	registeredControllersMu sync.RWMutex
+)
 
+// RegisterController registers controller c for all routers, see Router.RegisterController
 func RegisterController(c ControllerInterface) {
 	value := reflect.Indirect(reflect.ValueOf(c))
+
+	registeredControllersMu.Lock()
 	registeredControllers[value.Type().String()] = &value
+	registeredControllersMu.Unlock()
 }
@@ -2,6 +2,8 @@ package iafon
 
 import (
 	"net/http"
+	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -48,3 +50,141 @@ func TestHandleController(t *testing.T) {
 		t.Fatal("Controller method is not fired on request")
 	}
 }
+
+type TestStateController struct {
+	Controller
+	greeting string
+	count    int
+}
+
+func (t *TestStateController) Show() {
+	t.count++
+	controller_test_echo = t.greeting + " " + strconv.Itoa(t.count)
+}
+
+func TestRouterRegisterController(t *testing.T) {
+	r1 := newRouter()
+	r1.RegisterController(&TestStateController{greeting: "hello"})
+	r1.GET("/show", (*TestStateController).Show)
+
+	r2 := newRouter()
+	r2.RegisterController(&TestStateController{greeting: "hi"})
+	r2.GET("/show", (*TestStateController).Show)
+
+	for _, frozen := range []bool{false, true} {
+		if frozen {
+			r1.Freeze()
+			r2.Freeze()
+		}
+
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest("GET", "http://localhost/show", nil)
+
+			r1.ServeHTTP(nil, req)
+			if controller_test_echo != "hello 1" {
+				t.Fatal("each request should get a copy of controller registered to router, got:", controller_test_echo)
+			}
+
+			r2.ServeHTTP(nil, req)
+			if controller_test_echo != "hi 1" {
+				t.Fatal("routers should not share controllers registered, got:", controller_test_echo)
+			}
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("controller not registered to router should panic")
+		}
+	}()
+	newRouter().GET("/show", (*TestStateController).Show)
+}
+
+type TestPanicController struct {
+	Controller
+}
+
+var panic_controller *TestPanicController
+
+func (t *TestPanicController) Show() {
+	panic_controller = t
+	panic("controller panics")
+}
+
+func TestPanicControllerReused(t *testing.T) {
+	r := newRouter()
+	r.RegisterController(&TestPanicController{})
+	r.GET("/show", (*TestPanicController).Show)
+
+	for _, frozen := range []bool{false, true} {
+		if frozen {
+			r.Freeze()
+		}
+
+		panic_controller = nil
+
+		req, _ := http.NewRequest("GET", "http://localhost/show", nil)
+		r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+
+		if panic_controller == nil || panic_controller.Context != nil {
+			t.Fatal("controller panicking should be put back for reuse, frozen:", frozen)
+		}
+	}
+}
+
+func BenchmarkControllerServeHTTP(b *testing.B) {
+	RegisterController(&TestController{})
+
+	r := newRouter()
+	r.GET("/controller/:id", (*TestController).Index)
+
+	req, _ := http.NewRequest("GET", "http://localhost/controller/42", nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(nil, req)
+	}
+}
+
+type TestFieldsController struct {
+	Controller
+	Name  string
+	Limit int
+	Tags  []string
+}
+
+// BenchmarkFactoryReset measures the instance of controller for each request.
+// "new" creates an instance like before instances are reused, instance of controller with fields
+// besides the base struct is reset by reflection, which does not allocate either.
+func BenchmarkFactoryReset(b *testing.B) {
+	fields := &TestFieldsController{Name: "test", Limit: 10, Tags: []string{"a"}}
+	ctx := &Context{}
+
+	b.Run("new", func(b *testing.B) {
+		proto := reflect.ValueOf(fields).Elem()
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			v := reflect.New(proto.Type())
+			v.Elem().Set(proto)
+			v.Interface().(ControllerInterface).GetBaseController().Context = ctx
+		}
+	})
+
+	for _, test := range []struct {
+		name string
+		c    ControllerInterface
+	}{
+		{"only_base", &TestController{}},
+		{"fields", fields},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			f := newFactory(test.c)
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f.put(f.get(ctx))
+			}
+		})
+	}
+}
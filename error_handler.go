@@ -11,6 +11,10 @@ func handleErrorByDefault(code int, c *Context) {
 		http.Error(c.Rsp, "404 route not found", code)
 	case 405:
 		http.Error(c.Rsp, "405 method not allowed", code)
+	case 406:
+		http.Error(c.Rsp, "406 not acceptable", code)
+	case 415:
+		http.Error(c.Rsp, "415 unsupported media type", code)
 	case 500:
 		http.Error(c.Rsp, "500 internal server error", code)
 	default:
@@ -48,11 +48,16 @@ func TestHandler405(t *testing.T) {
 	error_handler_test_echo = ""
 
 	req, _ := http.NewRequest("POST", "http://localhost/test", nil)
-	r.ServeHTTP(nil, req)
+	w := &MockResponseWriter{header: http.Header{}}
+	r.ServeHTTP(w, req)
 
 	if error_handler_test_echo != "405" {
 		t.Fatal("405 Handler is not fired on request")
 	}
+
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Fatalf("Allow header of 405 response error, got '%s'", allow)
+	}
 }
 
 func TestHandler500(t *testing.T) {
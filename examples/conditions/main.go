@@ -0,0 +1,34 @@
+package main
+
+import (
+    "../../../iafon"
+    "fmt"
+)
+
+func main() {
+    s := iafon.NewServer(":8090")
+
+    // routes of the same method and pattern could be added with conditions,
+    // routes with more conditions are tried first, then in the order of adding
+    s.GET("/report", func (c *iafon.Context) {
+        fmt.Fprint(c.Rsp, "report v1\n")
+    })
+    s.GET("/report", func (c *iafon.Context) {
+        fmt.Fprint(c.Rsp, "report v2\n")
+    }, iafon.MatchAccept("application/vnd.acme.v2+json"))
+    s.GET("/report", func (c *iafon.Context) {
+        fmt.Fprint(c.Rsp, "a,b,c\n")
+    }, iafon.MatchQuery("format", "csv"))
+    s.GET("/report", func (c *iafon.Context) {
+        fmt.Fprint(c.Rsp, "debug report\n")
+    }, iafon.MatchHeader("X-Debug", "1"))
+
+    // conditions of group apply to its routes,
+    // request rejected by Content-Type gets 415, rejected by Accept gets 406
+    g := s.Group("/api").When(iafon.MatchContentType("application/json"))
+    g.POST("/report", func (c *iafon.Context) {
+        fmt.Fprint(c.Rsp, "report created\n")
+    })
+
+    s.Run()
+}
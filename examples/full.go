@@ -59,6 +59,8 @@ func (h *HttpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func init() {
     // controller must be registerd before using its method as route handler
+    // each request gets a copy of the controller or middleware registered, which is reused after the handler returns
+    // or panics like Context, so do not keep it after that
     iafon.RegisterController(&AController{})
     iafon.RegisterController(&BController{})
     iafon.RegisterController(&CController{})
@@ -202,9 +204,16 @@ func main() {
         //     // parameter in route pattern
         //     Param map[string]string
         //
+        //     // the same parameters in the order of route pattern
+        //     Params iafon.Params
+        //
         //     // we can put any thing in this map for passing through middlewares and main handler
         //     Udata map[string]interface{}  
         // }
+        //
+        // Context and its Params are reused by the next request after handler returns,
+        // so do not keep them, e.g. by a goroutine; copy what is needed instead.
+        // Param is a new map for each request, it could be kept
         fmt.Fprintf(c.Rsp, "Hello from iafon.HandlerFunc. param: %s\n", c.Param["param_name"])
     })
 
@@ -0,0 +1,31 @@
+package main
+
+import (
+    "../../../iafon"
+    "fmt"
+)
+
+func main() {
+    s := iafon.NewServer(":8090")
+
+    // exact host is tried first, then host pattern, then routes without host
+    s.GET("/dashboard", func (c *iafon.Context) {
+        fmt.Fprint(c.Rsp, "dashboard\n")
+    })
+    s.GET("admin.example.com/dashboard", func (c *iafon.Context) {
+        fmt.Fprint(c.Rsp, "admin dashboard\n")
+    })
+
+    // host param is merged into c.Param, "acme.example.com" gets c.Param["tenant"] == "acme"
+    g := s.Group(":tenant.example.com")
+    g.GET("/dashboard", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "dashboard of %s\n", c.Param["tenant"])
+    })
+
+    // "*" matches any one label of host
+    s.GET("*.example.com/health", func (c *iafon.Context) {
+        fmt.Fprint(c.Rsp, "ok\n")
+    })
+
+    s.Run()
+}
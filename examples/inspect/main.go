@@ -0,0 +1,27 @@
+package main
+
+import (
+    "../../../iafon"
+    "fmt"
+    "os"
+)
+
+func main() {
+    s := iafon.NewServer(":8090")
+
+    s.GET("/user/:id", func (c *iafon.Context) {})
+    s.GET("/user/admin", func (c *iafon.Context) {})
+    s.GET("x.org/user/:id", func (c *iafon.Context) {})
+
+    // conflicting and shadowed routes, and ambiguous param names
+    fmt.Print(s.Validate().String())
+
+    // which route serves a request, and why
+    fmt.Print(s.Explain("GET", "x.org", "/user/admin").String())
+
+    // routes as JSON with handler names and middlewares, and the route tree in Graphviz DOT,
+    // which could be diffed in code review: dot -Tsvg routes.dot > routes.svg
+    routes_json, _ := s.GetRoutes().JSON()
+    os.WriteFile("routes.json", routes_json, 0644)
+    os.WriteFile("routes.dot", []byte(s.RouteTree().DOT()), 0644)
+}
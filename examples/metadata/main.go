@@ -0,0 +1,24 @@
+package main
+
+import (
+    "../../../iafon"
+    "fmt"
+)
+
+func main() {
+    s := iafon.NewServer(":8090")
+
+    // metadata of group is inherited by its routes, route could override it,
+    // middlewares and handlers read metadata of the route serving request by c.Route().Meta(key)
+    g := s.Group("/account").SetMeta("perm", "user")
+
+    g.GET("/profile", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "profile, perm: %v\n", c.Route().Meta("perm"))
+    })
+
+    g.DELETE("/profile", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "profile deleted, perm: %v\n", c.Route().Meta("perm"))
+    }).SetMeta("perm", "admin")
+
+    s.Run()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+    "../../../iafon"
+    "fmt"
+)
+
+func main() {
+    s := iafon.NewServer(":8090")
+
+    // HEAD is served by GET route without body, OPTIONS is answered with Allow header "GET, HEAD, OPTIONS, PUT",
+    // and DELETE gets 405 with the same Allow header
+    // s.SetAutoHEAD(false).SetAutoOPTIONS(false).SetAllowHeader(false) disables them
+    s.GET("/user/:id", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "user %s\n", c.Param["id"])
+    })
+    s.PUT("/user/:id", func (c *iafon.Context) {})
+
+    // "/user//42" and "/user/./42" are redirected to "/user/42" by 307 by default,
+    // path policy could reply 404 or serve them directly instead
+    s.SetPathPolicy(iafon.PathPolicy{
+        TrailingSlash:     iafon.PathNotFound,
+        DotSegment:        iafon.PathServe,
+        RedirectCodeOther: 308,
+    })
+
+    // methods besides the standard ones should be registered before adding routes of them
+    s.RegisterMethod("PROPFIND", "MKCOL")
+    s.Some([]string{"PROPFIND", "MKCOL"}, "/dav/*path", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "%s %s\n", c.Req.Method, c.Param["path"])
+    })
+
+    s.Run()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+    "../../../iafon"
+    "net/http"
+    "fmt"
+    "time"
+)
+
+func main() {
+    s := iafon.NewServer(":8090")
+
+    // Wrap calls the middlewares and main handler after it by next,
+    // so it could run code after them, or recover their panic by defer
+    s.UseMiddleware(&TimerMiddleware{}, 100)
+
+    s.UseMiddleware(iafon.WrapFunc(func (c *iafon.Context, next func()) {
+        c.Rsp.Header().Set("X-Served-By", "iafon")
+        next()
+    }))
+
+    // middleware of net/http, handlers after it get the response writer and request it passes on,
+    // by a copy of Context, so it could call them by another goroutine like http.TimeoutHandler does
+    s.UseMiddleware(func (next http.Handler) http.Handler {
+        return http.TimeoutHandler(next, time.Second, "timeout")
+    })
+
+    auth := &AuthMiddleware{}
+    g := s.Group("/admin", auth)
+
+    // audit runs only for routes with metadata "audit"
+    g.UseMiddlewareIf(iafon.IfMeta("audit", true), &AuditMiddleware{})
+
+    // login is not authenticated
+    g.GET("/login", func (c *iafon.Context) {
+        fmt.Fprint(c.Rsp, "login\n")
+    }).SkipMiddleware(auth)
+
+    g.DELETE("/user/:id", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "user %s deleted\n", c.Param["id"])
+    }).SetMeta("audit", true)
+
+    s.Run()
+}
+
+type TimerMiddleware struct {
+    iafon.Middleware
+}
+
+func (m *TimerMiddleware) Wrap(next func()) {
+    start := time.Now()
+    next()
+    fmt.Println(m.Req.URL.Path, time.Since(start))
+}
+
+type AuthMiddleware struct {
+    iafon.Middleware
+}
+
+func (m *AuthMiddleware) Handle() bool {
+    if m.Req.Header.Get("Authorization") == "" {
+        http.Error(m.Rsp, "401 unauthorized", 401)
+        return false
+    }
+    return true
+}
+
+type AuditMiddleware struct {
+    iafon.Middleware
+}
+
+func (m *AuditMiddleware) Handle() bool {
+    fmt.Println("audit", m.Req.Method, m.Req.URL.Path)
+    return true
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+    "../../../iafon"
+    "net/http"
+    "fmt"
+)
+
+func main() {
+    s := iafon.NewServer(":8090")
+
+    // prefix is stripped from URL.Path, "/legacy/a/b" is forwarded as "/a/b",
+    // requests of any method under prefix are forwarded
+    s.Mount("/legacy", http.FileServer(http.Dir(".")))
+
+    // mounted router keeps its middlewares and error handlers, it gets params of prefix like c.Param["tid"]
+    billing := iafon.NewRouter()
+    billing.GET("/invoice/:id", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "invoice %s of %s\n", c.Param["id"], c.Param["tid"])
+    })
+    s.Mount("/tenant/:tid/billing", billing)
+
+    s.Run()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+    "../../../iafon"
+    "fmt"
+)
+
+type User struct {
+    ID   int    `json:"id"`
+    Name string `json:"name"`
+}
+
+type CreateUser struct {
+    Name string `json:"name"`
+}
+
+func main() {
+    s := iafon.NewServer(":8090")
+
+    g := s.Group("/user").SetMeta(iafon.MetaTags, []string{"user"})
+
+    g.GET("/:id", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "user %s\n", c.Param["id"])
+    }).SetMeta(iafon.MetaSummary, "show user").SetMeta(iafon.MetaResponse, User{})
+
+    // handlers are not typed, request and response schemas come from metadata only
+    g.POST("/", func (c *iafon.Context) {}).
+        SetMeta(iafon.MetaRequest, CreateUser{}).
+        SetMeta(iafon.MetaResponse, User{}).
+        SetMeta("perm", "admin")
+
+    g.DELETE("/:id", func (c *iafon.Context) {}).SetMeta(iafon.MetaDeprecated, "2025-01-01")
+
+    // OpenAPI 3.1 document in JSON and YAML, params of pattern are path parameters,
+    // other metadata like "perm" is added to operation as extension "x-perm"
+    s.ServeOpenAPI("/openapi.json", iafon.OpenAPIInfo{Title: "example", Version: "1.0.0"})
+    s.ServeOpenAPI("/openapi.yaml", iafon.OpenAPIInfo{Title: "example", Version: "1.0.0"})
+
+    s.Run()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+    "../../../iafon"
+    "fmt"
+)
+
+func main() {
+    s := iafon.NewServer(":8090")
+
+    // catch-all param matches the rest of path, slashes included, it must be the last segment
+    // "/static/css/app.css" gets c.Param["filepath"] == "css/app.css"
+    s.GET("/static/*filepath", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "file: %s\n", c.Param["filepath"])
+    })
+
+    // param could have a constraint in <>, which is a regexp or one of int alpha alnum hex uuid slug
+    // constrained param is tried before unconstrained param, "/number/42" is served by the first route
+    s.GET(`/number/:n<\d+>`, func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "number: %s\n", c.Param["n"])
+    })
+    s.GET("/number/:word", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "word: %s\n", c.Param["word"])
+    })
+
+    // several params in a segment, param is greedy: "/files/app.min.js" gets name "app.min" and ext "js"
+    s.GET("/files/:name.:ext", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "name: %s, ext: %s\n", c.Param["name"], c.Param["ext"])
+    })
+
+    // optional segment, "/report" and "/report/csv" are served by the same route,
+    // and "/summary" is an alias of it
+    s.GET("/report(/:format)?", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "format: %s\n", c.Param["format"])
+    }).Alias("/summary")
+
+    // url of named route
+    s.GET("/user/:id", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "user: %s\n", c.Param["id"])
+    }).Name("user.show")
+
+    s.GET("/me", func (c *iafon.Context) {
+        c.RedirectToRoute(302, "user.show", "id", "42")
+    })
+
+    fmt.Println(s.URL("user.show", "id", "42"))
+
+    s.Run()
+}
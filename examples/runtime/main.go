@@ -0,0 +1,30 @@
+package main
+
+import (
+    "../../../iafon"
+    "fmt"
+)
+
+func main() {
+    // the list matcher uses less memory for a few routes, the tree matcher is used by default
+    s := iafon.NewServerWithMatcher(&iafon.PatternMapByList{}, ":8090")
+
+    s.GET("/user/:id", func (c *iafon.Context) {
+        fmt.Fprintf(c.Rsp, "user %s\n", c.Param["id"])
+    })
+
+    maintenance := s.Any("/maintenance", func (c *iafon.Context) {
+        fmt.Fprint(c.Rsp, "under maintenance\n")
+    })
+
+    // routes could be added and removed while serving, requests being served are not affected
+    s.POST("/maintenance/done", func (c *iafon.Context) {
+        maintenance.Remove()
+        s.Remove("POST", "/maintenance/done")
+    })
+
+    // s.Freeze() or s.SetFreezeOnRun(true) validates and compiles routes to serve faster,
+    // routes could not be changed since then
+
+    s.Run()
+}
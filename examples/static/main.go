@@ -0,0 +1,21 @@
+package main
+
+import (
+    "../../../iafon"
+    "os"
+)
+
+func main() {
+    s := iafon.NewServer(":8090")
+
+    // files are served with ETag, Range and conditional requests,
+    // "app.js.br" or "app.js.gz" is served for "app.js" if accepted,
+    // paths not found get index.html, like a single page app
+    s.Static("/app", os.DirFS("./public"), iafon.StaticOptions{
+        Precompressed: true,
+        Fallback:      "index.html",
+        CacheControl:  "max-age=3600",
+    })
+
+    s.Run()
+}
@@ -0,0 +1,206 @@
+package iafon
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tHostPattern matches host with pattern like ":tenant.example.com" or "*.example.com".
+// a label of host pattern is static text, params mixed with static text like "api-:tenant",
+// or the wildcard "*" which matches any one label.
+type tHostPattern struct {
+	pattern string
+	labels  [][]tSubPattern
+
+	methods tMap_Method_RouteNode
+}
+
+// isHostPattern reports whether host should be matched as a pattern instead of exactly
+func isHostPattern(host string) bool {
+	return strings.ContainsAny(host, ":*")
+}
+
+func newHostPattern(host string) *tHostPattern {
+	hp := &tHostPattern{pattern: host, methods: make(tMap_Method_RouteNode)}
+
+	start := 0
+	for i := 0; i <= len(host); i++ {
+		if i < len(host) && host[i] == '<' {
+			// skip param constraint, which may contain '.'
+			if end := constraintEnd(host, i); end > 0 {
+				i = end
+			}
+			continue
+		}
+		if i < len(host) && host[i] != '.' {
+			continue
+		}
+		hp.labels = append(hp.labels, parseHostLabel(host, host[start:i]))
+		start = i + 1
+	}
+
+	return hp
+}
+
+func parseHostLabel(host, label string) []tSubPattern {
+	if label == "" {
+		panic("route: empty label in host pattern " + host)
+	}
+
+	if label == "*" {
+		return []tSubPattern{{pType: cSubPatternCatchAll}}
+	}
+
+	if strings.IndexByte(label, '*') >= 0 {
+		panic("route: wildcard * should be a whole label of host pattern " + host)
+	}
+
+	var parts []tSubPattern
+	for pos := 0; pos < len(label); {
+		pos_param := pos + strings.IndexByte(label[pos:], ':')
+		if pos_param < pos {
+			parts = append(parts, tSubPattern{pType: cSubPatternStatic, text: label[pos:]})
+			break
+		}
+		if pos_param > pos {
+			parts = append(parts, tSubPattern{pType: cSubPatternStatic, text: label[pos:pos_param]})
+		}
+		name, constraint, re, end := parseParam(label, pos_param)
+		parts = append(parts, tSubPattern{pType: cSubPatternParam, text: name, constraint: constraint, re: re})
+		pos = end
+	}
+	return parts
+}
+
+// params returns names of params in host pattern
+func (hp *tHostPattern) params() []string {
+	var names []string
+	for _, parts := range hp.labels {
+		for _, part := range parts {
+			if part.pType == cSubPatternParam {
+				names = append(names, part.text)
+			}
+		}
+	}
+	return names
+}
+
+// match matches host with pattern, matched params are appended to *ps
+func (hp *tHostPattern) match(host string, ps *Params) bool {
+	nparams := len(*ps)
+
+	for i, parts := range hp.labels {
+		label := host
+		if i < len(hp.labels)-1 {
+			pos := strings.IndexByte(host, '.')
+			if pos < 0 {
+				*ps = (*ps)[:nparams]
+				return false
+			}
+			label, host = host[:pos], host[pos+1:]
+		} else if strings.IndexByte(host, '.') >= 0 {
+			*ps = (*ps)[:nparams]
+			return false
+		}
+
+		if !matchHostLabel(parts, label, ps) {
+			*ps = (*ps)[:nparams]
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchHostLabel matches parts with label, param is greedy like params in path
+func matchHostLabel(parts []tSubPattern, label string, ps *Params) bool {
+	if len(parts) == 0 {
+		return label == ""
+	}
+
+	part := parts[0]
+
+	switch part.pType {
+	case cSubPatternStatic:
+		return strings.HasPrefix(label, part.text) && matchHostLabel(parts[1:], label[len(part.text):], ps)
+
+	case cSubPatternCatchAll:
+		return label != ""
+
+	default: // cSubPatternParam
+		// param value could not be empty
+		for end := len(label); end > 0; end-- {
+			value := label[:end]
+			if part.re != nil && !part.re.MatchString(value) {
+				continue
+			}
+
+			n := len(*ps)
+			*ps = append(*ps, Param{Key: part.text, Value: value})
+
+			if matchHostLabel(parts[1:], label[end:], ps) {
+				return true
+			}
+
+			*ps = (*ps)[:n]
+		}
+		return false
+	}
+}
+
+// priority of label, static is 0, constrained param is 1, param is 2, wildcard is 3
+func hostLabelPriority(parts []tSubPattern) int {
+	priority := 0
+	for _, part := range parts {
+		if p := part.priority(); p > priority {
+			priority = p
+		}
+	}
+	return priority
+}
+
+// before reports whether hp should be tried before other.
+// labels are compared from the right, the label with higher priority wins,
+// if all labels have the same priority, the pattern added first wins.
+func (hp *tHostPattern) before(other *tHostPattern) bool {
+	i, j := len(hp.labels)-1, len(other.labels)-1
+	for ; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		a, b := hostLabelPriority(hp.labels[i]), hostLabelPriority(other.labels[j])
+		if a != b {
+			return a < b
+		}
+	}
+	return false
+}
+
+// addHostPattern adds rn for host pattern, host patterns are kept in the order of matching
+func (m *tMap_Host_Method_RouteNode) addHostPattern(host, pattern string, rn *RouteNode) {
+	hp := newHostPattern(host)
+
+	// checked for every route, the same host pattern may be added with path params of other names before
+	for _, name := range hp.params() {
+		for _, path_param := range patternParams(pattern) {
+			if name == path_param {
+				panic(fmt.Sprintf("route: param '%s' is in both host and path of pattern %s", name, host+pattern))
+			}
+		}
+	}
+
+	for _, added := range m.hostPatterns {
+		if added.pattern == host {
+			added.methods.add(rn, host+pattern)
+			return
+		}
+	}
+
+	hp.methods.add(rn, host+pattern)
+
+	i := len(m.hostPatterns)
+	for i > 0 && hp.before(m.hostPatterns[i-1]) {
+		i--
+	}
+
+	m.hostPatterns = append(m.hostPatterns, nil)
+	copy(m.hostPatterns[i+1:], m.hostPatterns[i:])
+	m.hostPatterns[i] = hp
+}
@@ -0,0 +1,79 @@
+package iafon
+
+import (
+	"testing"
+)
+
+func TestMatchHostPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		host    string
+		matched bool
+		params  map[string]string
+	}{
+		{":tenant.example.com", "acme.example.com", true, map[string]string{"tenant": "acme"}},
+		{":tenant.example.com", "example.com", false, nil},
+		{":tenant.example.com", "a.b.example.com", false, nil},
+		{":tenant.example.com", "acme.example.org", false, nil},
+		{"*.example.com", "acme.example.com", true, nil},
+		{"*.example.com", "a.b.example.com", false, nil},
+		{"api-:tenant<alpha>.example.com", "api-acme.example.com", true, map[string]string{"tenant": "acme"}},
+		{"api-:tenant<alpha>.example.com", "api-42.example.com", false, nil},
+		{":sub.:domain.com", "www.iafon.com", true, map[string]string{"sub": "www", "domain": "iafon"}},
+		{":name-:region.example.com", "shop-eu-west.example.com", true, map[string]string{"name": "shop-eu", "region": "west"}},
+		{`:v<\d+\.\d+>.api.com`, "1.2.api.com", false, nil},
+	}
+
+	for _, c := range cases {
+		var params Params
+		hp := newHostPattern(c.pattern)
+
+		if matched := hp.match(c.host, &params); matched != c.matched {
+			t.Fatalf("match host '%s' with '%s' error, expected %t, got %t", c.host, c.pattern, c.matched, matched)
+		}
+
+		if len(params) != len(c.params) {
+			t.Fatalf("match host '%s' with '%s' params error, expected %v, got %v", c.host, c.pattern, c.params, params)
+		}
+		for k, v := range c.params {
+			if params.Get(k) != v {
+				t.Fatalf("match host '%s' with '%s' params error, expected %v, got %v", c.host, c.pattern, c.params, params)
+			}
+		}
+	}
+}
+
+func TestInvalidHostPattern(t *testing.T) {
+	invalid := []string{
+		"*x.example.com",
+		"a..example.com",
+		":.example.com",
+		":tenant:x.example.com",
+		".example.com",
+	}
+
+	for _, p := range invalid {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("invalid host pattern '%s' should panic", p)
+				}
+			}()
+			newHostPattern(p)
+		}()
+	}
+}
+
+func TestHostPatternOrder(t *testing.T) {
+	m := &tMap_Host_Method_RouteNode{}
+	for _, host := range []string{"*.example.com", ":tenant.example.com", ":id<int>.example.com", "www.:domain.com", "api.example.com"} {
+		m.addHostPattern(host, "/", &RouteNode{method: "GET"})
+	}
+
+	expected := []string{"api.example.com", ":id<int>.example.com", ":tenant.example.com", "*.example.com", "www.:domain.com"}
+	for i, hp := range m.hostPatterns {
+		if hp.pattern != expected[i] {
+			t.Fatalf("host pattern order error, expected %s at %d, got %s", expected[i], i, hp.pattern)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package iafon
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"reflect"
 )
 
@@ -10,43 +13,144 @@ type MiddlewareInterface interface {
 	Handle() bool
 }
 
-var middlewareAddOrder int16
+// Wrapper is middleware wrapping the middlewares and main handler after it, which are called by next,
+// so it could run code before and after them, like timing request or recovering panic by defer:
+//
+//	func (m *TimerMiddleware) Wrap(next func()) {
+//		start := time.Now()
+//		next()
+//		log.Println(m.Req.URL.Path, time.Since(start))
+//	}
+//
+// Handle of Wrapper is not called. handlers after it are not called if Wrap does not call next.
+// Wrapper is sorted with other middlewares by ExecOrder.
+type Wrapper interface {
+	MiddlewareInterface
+	Wrap(next func())
+}
+
+// WrapFunc returns a Wrapper calling f, like UseMiddleware(iafon.WrapFunc(func(c *iafon.Context, next func()) {...}))
+func WrapFunc(f func(c *Context, next func())) MiddlewareInterface {
+	if f == nil {
+		panic("http: nil middleware function")
+	}
+	return &tWrapFunc{f: f}
+}
+
+type tWrapFunc struct {
+	Middleware
+	f func(*Context, func())
+}
+
+func (m *tWrapFunc) Wrap(next func()) {
+	m.f(m.Context, next)
+}
+
+var httpMiddlewareType = reflect.TypeOf((func(http.Handler) http.Handler)(nil))
+
+// toMiddleware returns m as MiddlewareInterface.
+// middleware of net/http like func(http.Handler) http.Handler, or a named type of it, is adapted as Wrapper.
+func toMiddleware(m interface{}) MiddlewareInterface {
+	switch m := m.(type) {
+	case MiddlewareInterface:
+		return m
+	case func(http.Handler) http.Handler:
+		return newHTTPMiddleware(m)
+	}
+
+	if v := reflect.ValueOf(m); v.IsValid() && v.Type().ConvertibleTo(httpMiddlewareType) {
+		return newHTTPMiddleware(v.Convert(httpMiddlewareType).Interface().(func(http.Handler) http.Handler))
+	}
+
+	panic(fmt.Sprintf("invalid middleware type: %T", m))
+}
 
-// map from MiddlewareInterface.RealExecOrder to *reflect.Value
-var addedMiddlewares = make(map[int]*reflect.Value)
+// HTTPMiddleware adapts middleware of net/http, it is done by UseMiddleware also,
+// but the value returned could be skipped by SkipMiddleware, like:
+//
+//	cors := iafon.HTTPMiddleware(handlers.CORS())
+//	g.UseMiddleware(cors)
+//	g.GET("/internal", handler).SkipMiddleware(cors)
+func HTTPMiddleware(f func(http.Handler) http.Handler) MiddlewareInterface {
+	return newHTTPMiddleware(f)
+}
+
+// tHTTPMiddleware adapts func(http.Handler) http.Handler as middleware wrapping the handlers after it,
+// the handler of net/http middleware is created once, handlers after it are called by tHTTPMiddlewareNext
+type tHTTPMiddleware struct {
+	Middleware
+	f       func(http.Handler) http.Handler
+	handler http.Handler
+}
+
+// tHTTPMiddlewareNext is passed by request context to the handler wrapped by net/http middleware
+type tHTTPMiddlewareNext struct {
+	ctx  *Context
+	next func(*Context)
+}
 
-func markMiddlewareAsAdded(m MiddlewareInterface, execOrder ...int16) {
-	middlewareAddOrder++
+type tHTTPMiddlewareKey struct{}
 
-	baseMiddleware := m.GetBaseMiddleware()
-	baseMiddleware.addOrder = middlewareAddOrder
+func newHTTPMiddleware(f func(http.Handler) http.Handler) *tHTTPMiddleware {
+	if f == nil {
+		panic("http: nil middleware function")
+	}
 
-	if len(execOrder) > 0 {
-		baseMiddleware.ExecOrder = execOrder[0]
+	handler := f(http.HandlerFunc(serveHTTPMiddlewareNext))
+	if handler == nil {
+		panic("http: middleware function returns nil handler")
 	}
 
-	value := reflect.Indirect(reflect.ValueOf(m))
-	addedMiddlewares[m.RealExecOrder()] = &value
+	return &tHTTPMiddleware{f: f, handler: handler}
 }
 
-// custom middleware should embed base Middleware
+// serve calls net/http middleware for request of c, next calls handlers after it.
+// middleware may call next by another goroutine, even after it returns, like http.TimeoutHandler,
+// so handlers after it get a copy of c, which is not reused by other requests.
+func (m *tHTTPMiddleware) serve(c *Context, next func(*Context)) {
+	nc := *c
+	nc.Params = append(Params(nil), c.Params...)
+
+	req := c.Req.WithContext(context.WithValue(c.Req.Context(), tHTTPMiddlewareKey{}, &tHTTPMiddlewareNext{ctx: &nc, next: next}))
+	m.handler.ServeHTTP(c.Rsp, req)
+}
+
+// serveHTTPMiddlewareNext is the handler wrapped by net/http middleware,
+// response writer and request it gets are used by handlers after the middleware
+func serveHTTPMiddlewareNext(w http.ResponseWriter, req *http.Request) {
+	n, ok := req.Context().Value(tHTTPMiddlewareKey{}).(*tHTTPMiddlewareNext)
+	if !ok {
+		panic("http: context of request is replaced by middleware, which should be derived from the original")
+	}
+
+	n.ctx.Rsp, n.ctx.Req = w, req
+	n.next(n.ctx)
+}
+
+// custom middleware should embed base Middleware.
+// each request gets a copy of the middleware used, the copy is reused after request like Context.
 type Middleware struct {
 	*Context
 
+	// middlewares of higher exec order run first, those of negative exec order run after the main handler.
+	// middlewares of the same exec order run in the order they are used first in router.
 	ExecOrder int16
-	addOrder  int16
 }
 
 func (m *Middleware) GetBaseMiddleware() *Middleware {
 	return m
 }
 
+// RealExecOrder returns order of middleware relative to the main handler, whose order is 0
 func (m *Middleware) RealExecOrder() int {
-	execOrder := m.ExecOrder
+	return realExecOrder(m.ExecOrder)
+}
+
+func realExecOrder(execOrder int16) int {
 	if execOrder >= 0 {
-		execOrder += 1
+		return int(execOrder) + 1
 	}
-	return (int(execOrder) << 16) - int(m.addOrder)
+	return int(execOrder)
 }
 
 func (m *Middleware) Handle() bool {
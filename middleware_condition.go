@@ -0,0 +1,115 @@
+package iafon
+
+import (
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// MiddlewareCondition decides whether a middleware runs for request, see RouteGroup.UseMiddlewareIf.
+// it is called for each request before the middleware, c.Route() is the route serving the request.
+type MiddlewareCondition func(c *Context) bool
+
+// IfPath is satisfied if path of request matches glob by path.Match, like "/admin/*".
+// "*" does not match "/", glob ending with "/**" matches all paths under it.
+func IfPath(glob string) MiddlewareCondition {
+	if _, err := path.Match(glob, ""); err != nil {
+		panic("route: invalid path glob " + glob)
+	}
+
+	if prefix := strings.TrimSuffix(glob, "/**"); prefix != glob {
+		n := strings.Count(prefix, "/")
+		return func(c *Context) bool {
+			// the first n segments of path are matched by prefix
+			p := c.Req.URL.Path
+			for i, seen := 0, 0; i < len(p); i++ {
+				if p[i] == '/' {
+					if seen++; seen > n {
+						p = p[:i]
+						break
+					}
+				}
+			}
+			ok, _ := path.Match(prefix, p)
+			return ok
+		}
+	}
+
+	return func(c *Context) bool {
+		ok, _ := path.Match(glob, c.Req.URL.Path)
+		return ok
+	}
+}
+
+// IfMethod is satisfied if method of request is any of methods
+func IfMethod(methods ...string) MiddlewareCondition {
+	set := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		set[strings.ToUpper(method)] = true
+	}
+
+	return func(c *Context) bool {
+		return set[c.Req.Method]
+	}
+}
+
+// IfHeader is satisfied if header key of request is value, or header key is present if value is empty
+func IfHeader(key, value string) MiddlewareCondition {
+	key = http.CanonicalHeaderKey(key)
+
+	return func(c *Context) bool {
+		values, ok := c.Req.Header[key]
+		if value == "" {
+			return ok
+		}
+		return ok && values[0] == value
+	}
+}
+
+// IfMeta is satisfied if metadata key of the route serving request is value, or metadata key is set if value is nil
+func IfMeta(key string, value interface{}) MiddlewareCondition {
+	return func(c *Context) bool {
+		if c.route == nil {
+			return false
+		}
+		v, ok := c.route.load().meta[key]
+		if value == nil {
+			return ok
+		}
+		return ok && reflect.DeepEqual(v, value)
+	}
+}
+
+// IfNot is satisfied if cond is not, like IfNot(IfPath("/admin/login"))
+func IfNot(cond MiddlewareCondition) MiddlewareCondition {
+	return func(c *Context) bool {
+		return !cond(c)
+	}
+}
+
+// tGroupMiddleware is a middleware used by group, with the condition it runs under
+type tGroupMiddleware struct {
+	m    MiddlewareInterface
+	cond MiddlewareCondition
+}
+
+// skipsMiddleware reports whether m is in skipped.
+// functions of net/http middleware could not be compared, they are skipped by the value of HTTPMiddleware.
+func skipsMiddleware(skipped []MiddlewareInterface, m MiddlewareInterface) bool {
+	for _, s := range skipped {
+		if s == m {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSkippedMiddlewares panics if any of middlewares is nil
+func checkSkippedMiddlewares(middlewares []MiddlewareInterface) {
+	for _, m := range middlewares {
+		if m == nil {
+			panic("route: nil middleware to skip")
+		}
+	}
+}
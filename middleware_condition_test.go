@@ -0,0 +1,176 @@
+package iafon
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareCondition(t *testing.T) {
+	var tests = []struct {
+		cond     MiddlewareCondition
+		method   string
+		path     string
+		header   map[string]string
+		expected bool
+	}{
+		{IfPath("/admin/*"), "GET", "/admin/user", nil, true},
+		{IfPath("/admin/*"), "GET", "/admin/user/1", nil, false},
+		{IfPath("/admin/**"), "GET", "/admin/user/1", nil, true},
+		{IfPath("/admin/**"), "GET", "/admin", nil, true},
+		{IfPath("/admin/**"), "GET", "/administrator", nil, false},
+		{IfPath("/*/edit/**"), "GET", "/user/edit/1", nil, true},
+		{IfPath("/**"), "GET", "/any/path", nil, true},
+		{IfMethod("post", "PUT"), "POST", "/", nil, true},
+		{IfMethod("POST"), "GET", "/", nil, false},
+		{IfHeader("x-debug", ""), "GET", "/", map[string]string{"X-Debug": "0"}, true},
+		{IfHeader("X-Debug", "1"), "GET", "/", map[string]string{"X-Debug": "0"}, false},
+		{IfNot(IfPath("/admin/login")), "GET", "/admin/login", nil, false},
+	}
+
+	for i, test := range tests {
+		req, _ := http.NewRequest(test.method, "http://localhost"+test.path, nil)
+		for key, value := range test.header {
+			req.Header.Set(key, value)
+		}
+		if test.cond(&Context{Req: req}) != test.expected {
+			t.Fatalf("middleware condition error. test: %d, req: %s %s, expected: %v", i, test.method, test.path, test.expected)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("invalid path glob should panic")
+		}
+	}()
+	IfPath("/[")
+}
+
+func TestSkipMiddleware(t *testing.T) {
+	var echo []string
+
+	auth := &TestEchoMiddleware{echo: "auth"}
+	cors := HTTPMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			echo = append(echo, "cors")
+			next.ServeHTTP(w, req)
+		})
+	})
+
+	r := newRouter()
+	r.Group("/admin", auth, func(g *RouteGroup) {
+		g.GET("/login", func(*Context) {}).SkipMiddleware(auth, cors)
+		g.GET("/user", func(*Context) {})
+		g.Group("/public", func(g *RouteGroup) {
+			g.GET("/about", func(*Context) {})
+		}).SkipMiddleware(auth)
+	})
+	// used after routes are skipping it
+	r.UseMiddleware(cors, 10)
+	r.GET("/admin/public/news", func(*Context) {})
+
+	var tests = []struct {
+		path     string
+		expected string
+	}{
+		{"/admin/login", ""},
+		{"/admin/user", "cors,auth"},
+		{"/admin/public/about", "cors"},
+		{"/admin/public/news", "cors"},
+	}
+
+	for _, test := range tests {
+		wrapper_test_echo = nil
+		echo = nil
+
+		req, _ := http.NewRequest("GET", "http://localhost"+test.path, nil)
+		r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+
+		if got := strings.Join(append(echo, wrapper_test_echo...), ","); got != test.expected {
+			t.Fatalf("skip middleware error. path: %s, expected: %s, got: %s", test.path, test.expected, got)
+		}
+	}
+}
+
+func TestSkipHTTPMiddlewareOfSameFunction(t *testing.T) {
+	var echo []string
+
+	// closures of the same function
+	echoMiddleware := func(s string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				echo = append(echo, s)
+				next.ServeHTTP(w, req)
+			})
+		}
+	}
+	a := HTTPMiddleware(echoMiddleware("a"))
+	b := HTTPMiddleware(echoMiddleware("b"))
+
+	r := newRouter()
+	r.UseMiddleware(a)
+	r.UseMiddleware(b)
+	r.GET("/a", func(*Context) {}).SkipMiddleware(b)
+	r.GET("/b", func(*Context) {}).SkipMiddleware(a)
+
+	for path, expected := range map[string]string{"/a": "a", "/b": "b"} {
+		echo = nil
+
+		req, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+		r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+
+		if got := strings.Join(echo, ","); got != expected {
+			t.Fatalf("skip middleware error. path: %s, expected: %s, got: %s", path, expected, got)
+		}
+	}
+}
+
+func TestUseMiddlewareIf(t *testing.T) {
+	r := newRouter()
+	r.UseMiddlewareIf(IfPath("/admin/**"), &TestEchoMiddleware{echo: "admin"}, 2)
+	r.UseMiddlewareIf(IfMeta("audit", true), &TestEchoMiddleware{echo: "audit"}, 1)
+	r.UseMiddlewareIf(IfMethod("POST"), WrapFunc(func(c *Context, next func()) {
+		wrapper_test_echo = append(wrapper_test_echo, "post")
+		next()
+	}))
+
+	handler := func(*Context) { wrapper_test_echo = append(wrapper_test_echo, "handler") }
+	r.GET("/admin/user", handler).SetMeta("audit", true)
+	r.POST("/admin/user", handler)
+	r.POST("/user", handler)
+	r.GET("/user", handler)
+
+	var tests = []struct {
+		method, path string
+		expected     string
+	}{
+		{"GET", "/admin/user", "admin,audit,handler"},
+		{"POST", "/admin/user", "admin,post,handler"},
+		{"POST", "/user", "post,handler"},
+		{"GET", "/user", "handler"},
+	}
+
+	for _, frozen := range []bool{false, true} {
+		if frozen {
+			if err := r.Freeze(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, test := range tests {
+			wrapper_test_echo = nil
+
+			req, _ := http.NewRequest(test.method, "http://localhost"+test.path, nil)
+			r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+
+			if got := strings.Join(wrapper_test_echo, ","); got != test.expected {
+				t.Fatalf("conditional middleware error. req: %s %s, frozen: %v, expected: %s, got: %s",
+					test.method, test.path, frozen, test.expected, got)
+			}
+		}
+	}
+
+	if info := r.GetRoutes()[0].Info(); !info.Middlewares[0].Conditional {
+		t.Fatal("conditional middleware should be exported as conditional")
+	}
+}
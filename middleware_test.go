@@ -1,8 +1,14 @@
 package iafon
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var middleware_test_echo string
@@ -135,3 +141,319 @@ func TestUseMiddlewareAsHandler(t *testing.T) {
 	r := newRouter()
 	r.Handle("GET", "/", &TestMiddleware{})
 }
+
+var wrapper_test_echo []string
+
+type TestEchoMiddleware struct {
+	Middleware
+	echo string
+}
+
+func (t *TestEchoMiddleware) Handle() bool {
+	wrapper_test_echo = append(wrapper_test_echo, t.echo)
+	return t.echo != "stop"
+}
+
+type TestWrapperMiddleware struct {
+	Middleware
+}
+
+func (t *TestWrapperMiddleware) Wrap(next func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			wrapper_test_echo = append(wrapper_test_echo, "recovered")
+		}
+	}()
+
+	wrapper_test_echo = append(wrapper_test_echo, "wrap before")
+	next()
+	wrapper_test_echo = append(wrapper_test_echo, "wrap after")
+}
+
+func TestWrapMiddleware(t *testing.T) {
+	r := newRouter()
+	r.UseMiddleware(&TestEchoMiddleware{echo: "a"}, 10)
+	r.UseMiddleware(&TestWrapperMiddleware{}, 5)
+	r.UseMiddleware(&TestEchoMiddleware{echo: "b"}, 1)
+	r.UseMiddleware(&TestEchoMiddleware{echo: "c"}, -1)
+	r.UseMiddleware(WrapFunc(func(c *Context, next func()) {
+		wrapper_test_echo = append(wrapper_test_echo, "func "+c.Req.URL.Path)
+		next()
+	}), 0)
+
+	r.GET("/ok", func(*Context) { wrapper_test_echo = append(wrapper_test_echo, "handler") })
+	r.GET("/panic", func(*Context) { panic("handler") })
+	r.GET("/stop", func(*Context) { wrapper_test_echo = append(wrapper_test_echo, "handler") }).
+		UseMiddleware(&TestEchoMiddleware{echo: "stop"}, 3)
+
+	var tests = []struct {
+		path     string
+		expected string
+	}{
+		{"/ok", "a,wrap before,b,func /ok,handler,c,wrap after"},
+		{"/panic", "a,wrap before,b,func /panic,recovered"},
+		{"/stop", "a,wrap before,stop,wrap after"},
+	}
+
+	for _, frozen := range []bool{false, true} {
+		if frozen {
+			if err := r.Freeze(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, test := range tests {
+			wrapper_test_echo = nil
+
+			req, _ := http.NewRequest("GET", "http://localhost"+test.path, nil)
+			r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+
+			if got := strings.Join(wrapper_test_echo, ","); got != test.expected {
+				t.Fatalf("wrap middleware error. path: %s, frozen: %v, expected: %s, got: %s", test.path, frozen, test.expected, got)
+			}
+		}
+	}
+}
+
+type testHTTPMiddlewareFunc func(http.Handler) http.Handler
+
+type testHTTPResponseWriter struct {
+	http.ResponseWriter
+}
+
+type testHTTPContextKey struct{}
+
+func TestHTTPMiddleware(t *testing.T) {
+	var echo string
+
+	with_value := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := context.WithValue(req.Context(), testHTTPContextKey{}, "value")
+			next.ServeHTTP(&testHTTPResponseWriter{w}, req.WithContext(ctx))
+		})
+	}
+	deny := testHTTPMiddlewareFunc(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("X-Deny") != "" {
+				w.WriteHeader(403)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	})
+
+	r := newRouter()
+	r.UseMiddleware(WrapFunc(func(c *Context, next func()) {
+		rsp := c.Rsp
+		next()
+		if c.Rsp != rsp {
+			echo += " not restored"
+		}
+	}), 100)
+	r.Group("/api", with_value, func(g *RouteGroup) {
+		g.GET("/user", func(c *Context) {
+			_, wrapped := c.Rsp.(*testHTTPResponseWriter)
+			echo = fmt.Sprintf("%v %v", c.Req.Context().Value(testHTTPContextKey{}), wrapped)
+		}).UseMiddleware(deny, 10)
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost/api/user", nil)
+	r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+	if echo != "value true" {
+		t.Fatal("handler should get request and response writer of net/http middleware, got:", echo)
+	}
+
+	echo = ""
+	req.Header.Set("X-Deny", "1")
+	w := &MockResponseWriter{header: http.Header{}}
+	r.ServeHTTP(w, req)
+	if w.code != 403 || echo != "" {
+		t.Fatal("net/http middleware should stop request, got:", w.code, echo)
+	}
+
+	if name := r.GetRoutes()[0].Info().Middlewares[1].Name; !strings.HasPrefix(name, "TestHTTPMiddleware.func") {
+		t.Fatal("name of net/http middleware should be its function, got:", name)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("using invalid middleware should panic")
+		}
+	}()
+	r.UseMiddleware(func(*Context) {})
+}
+
+// run with -race, handlers after http.TimeoutHandler keep running after the request has timed out
+func TestHTTPMiddlewareAsync(t *testing.T) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var served []string
+
+	r := newRouter()
+	r.UseMiddleware(func(next http.Handler) http.Handler {
+		return http.TimeoutHandler(next, time.Millisecond, "timeout")
+	}, 10)
+	r.UseMiddleware(WrapFunc(func(c *Context, next func()) {
+		defer wg.Done()
+		next()
+	}))
+	r.GET("/user/:id", func(c *Context) {
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		served = append(served, c.Req.URL.Path+" "+c.Param["id"]+" "+c.Params.Get("id"))
+		mu.Unlock()
+		c.Rsp.Write([]byte("too late"))
+	})
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		req, _ := http.NewRequest("GET", "http://localhost/user/"+strconv.Itoa(i), nil)
+		w := &MockResponseWriter{header: http.Header{}}
+		r.ServeHTTP(w, req)
+		if w.code != http.StatusServiceUnavailable || w.data != "timeout" {
+			t.Fatal("request should time out, got:", w.code, w.data)
+		}
+	}
+	wg.Wait()
+
+	if len(served) != 20 {
+		t.Fatal("handlers should be called after timeout, got:", served)
+	}
+	for _, s := range served {
+		fields := strings.Fields(s)
+		if fields[0] != "/user/"+fields[1] || fields[1] != fields[2] {
+			t.Fatal("handler after timeout should get params of its own request, got:", s)
+		}
+	}
+}
+
+type TestStateMiddleware struct {
+	Middleware
+	calls int
+}
+
+func (t *TestStateMiddleware) Handle() bool {
+	t.calls++
+	middleware_test_echo = strconv.Itoa(t.calls)
+	return true
+}
+
+func TestMiddlewareInstance(t *testing.T) {
+	m := &TestStateMiddleware{calls: 10}
+
+	r := newRouter()
+	r.UseMiddleware(m)
+	r.GET("/a", func(*Context) {})
+	r.GET("/b", func(*Context) {})
+
+	for _, path := range []string{"/a", "/b", "/a"} {
+		req, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+		r.ServeHTTP(nil, req)
+		if middleware_test_echo != "11" {
+			t.Fatal("each request should get a copy of middleware used, got:", middleware_test_echo)
+		}
+	}
+
+	if m.calls != 10 || len(r.registry.middlewares) != 1 {
+		t.Fatal("middleware used should not be changed by requests, and shared by routes")
+	}
+}
+
+type TestSeqMiddleware struct {
+	Middleware
+	seq *[]int
+	i   int
+}
+
+func (t *TestSeqMiddleware) Handle() bool {
+	*t.seq = append(*t.seq, t.i)
+	return true
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var seq []int
+
+	// more middlewares than int16 could count, of the same exec order
+	n := 40000
+
+	r := newRouter()
+	rn := r.GET("/", func(*Context) {})
+	for i := 0; i < n; i++ {
+		rn.UseMiddleware(&TestSeqMiddleware{seq: &seq, i: i})
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost/", nil)
+	r.ServeHTTP(nil, req)
+
+	if len(seq) != n {
+		t.Fatal("all middlewares should run, got:", len(seq))
+	}
+	for i := range seq {
+		if seq[i] != i {
+			t.Fatal("middlewares of the same exec order should run in the order they are used, got:", seq[i], "at", i)
+		}
+	}
+
+	// the same middleware has its own exec order in each router
+	m := &TestSeqMiddleware{seq: &seq, i: -1}
+	for _, order := range []int16{5, -5} {
+		r := newRouter()
+		r.UseMiddleware(m, order)
+		r.GET("/", func(*Context) { seq = append(seq, 0) })
+		r.GET("/b", func(*Context) {}).UseMiddleware(&TestSeqMiddleware{seq: &seq, i: 1})
+
+		seq = nil
+		r.ServeHTTP(nil, req)
+
+		expected := "[-1 0]"
+		if order < 0 {
+			expected = "[0 -1]"
+		}
+		if fmt.Sprint(seq) != expected {
+			t.Fatalf("exec order of middleware in router error, expected: %s, got: %v", expected, seq)
+		}
+	}
+}
+
+func TestMiddlewareConcurrentRouters(t *testing.T) {
+	m := &Middleware{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			r := newRouter()
+			r.UseMiddleware(m, int16(i))
+			r.UseMiddleware(WrapFunc(func(c *Context, next func()) { next() }))
+			r.RegisterController(&TestStateController{greeting: "hi"})
+			r.GET("/show", (*TestStateController).Show)
+			r.GET("/", func(*Context) {})
+			r.Freeze()
+
+			req, _ := http.NewRequest("GET", "http://localhost/", nil)
+			r.ServeHTTP(nil, req)
+
+			if info := r.GetRoutes()[1].Info(); info.Middlewares[0].ExecOrder != int16(i) {
+				t.Error("exec order of middleware should be kept by each router, got:", info.Middlewares[0].ExecOrder)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkMiddlewareServeHTTP(b *testing.B) {
+	r := newRouter()
+	r.UseMiddleware(&TestMiddleware{})
+	r.UseMiddleware(&TestMiddleware1{}, -1)
+	r.GET("/user/:id", func(*Context) {})
+
+	req, _ := http.NewRequest("GET", "http://localhost/user/42", nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(nil, req)
+	}
+}
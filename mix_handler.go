@@ -23,19 +23,27 @@ type tMixHandler struct {
 	iafonHandler Handler
 
 	controllerMethod reflect.Value
-	controllerValue  *reflect.Value
 
-	middlewareValue *reflect.Value
+	// instances of controller or middleware for requests
+	factory *tFactory
+	// the middleware used, for RouteNode.SkipMiddleware
+	middleware MiddlewareInterface
+	// middleware is a Wrapper
+	wrapper bool
+	// middleware runs only if cond is satisfied, see RouteGroup.UseMiddlewareIf
+	cond MiddlewareCondition
 
-	// execution order
+	// execution order, see realExecOrder
 	order int
+	// middlewares of the same order are sorted by seq, see tRegistry
+	seq       uint64
+	execOrder int16
 }
 
-func newMixHandler(handler interface{}) *tMixHandler {
+// newMixHandler returns handler for routes of r, controllers and middlewares are in the registry of r
+func newMixHandler(r *Router, handler interface{}) *tMixHandler {
 	h := &tMixHandler{}
 
-	h.order = 0
-
 	switch handler := handler.(type) {
 	case http.Handler:
 		h.hType = cHTYPE_HTTP_HANDLER
@@ -58,9 +66,17 @@ func newMixHandler(handler interface{}) *tMixHandler {
 		h.iafonHandler = HandlerFunc(handler)
 
 	case MiddlewareInterface:
-		h.order = handler.RealExecOrder()
+		reg := r.registerMiddleware(handler)
 		h.hType = cHTYPE_MIDDLEWARE
-		h.middlewareValue = addedMiddlewares[h.order]
+		h.middleware = handler
+		h.factory = reg.factory
+		h.execOrder = reg.execOrder
+		h.order = realExecOrder(reg.execOrder)
+		h.seq = reg.seq
+		_, h.wrapper = handler.(Wrapper)
+		if _, ok := handler.(*tHTTPMiddleware); ok {
+			h.wrapper = true
+		}
 	default:
 		// controller method
 		t := fmt.Sprintf("%T", handler)
@@ -90,13 +106,13 @@ func newMixHandler(handler interface{}) *tMixHandler {
 			panic(panic_msg)
 		}
 
-		if _, ok := registeredControllers[controllerTypeName]; !ok {
+		h.factory = r.controllerFactory(controllerTypeName)
+		if h.factory == nil {
 			panic("not registered controller type: " + controllerTypeName)
 		}
 
 		h.hType = cHTYPE_CONTROLLER
 		h.controllerMethod = reflect.ValueOf(handler)
-		h.controllerValue = registeredControllers[controllerTypeName]
 	}
 
 	return h
@@ -110,25 +126,58 @@ func (h *tMixHandler) call(ctx *Context) bool {
 	case cHTYPE_IAFON_HANDLER:
 		h.iafonHandler.Handle(ctx)
 	case cHTYPE_MIDDLEWARE:
-		mValue := reflect.New(h.middlewareValue.Type())
-		mValue.Elem().Set(*h.middlewareValue)
-
-		m := mValue.Interface().(MiddlewareInterface)
-		m.GetBaseMiddleware().Context = ctx
-
-		next = m.Handle()
+		inst := h.factory.get(ctx)
+		defer h.factory.put(inst)
+		next = inst.middleware.Handle()
 	case cHTYPE_CONTROLLER:
-		cValue := reflect.New(h.controllerValue.Type())
-		cValue.Elem().Set(*h.controllerValue)
-
-		c := cValue.Interface().(ControllerInterface)
-		c.GetBaseController().Context = ctx
-
+		inst := h.factory.get(ctx)
+		defer h.factory.put(inst)
+		c := inst.controller
 		c.Initialize()
-		h.controllerMethod.Call([]reflect.Value{cValue})
+		h.controllerMethod.Call(inst.args)
 		c.Finalize()
 	default:
 		panic("invalid handler type")
 	}
 	return next
 }
+
+// wrap calls h which is a Wrapper or net/http middleware, next calls handlers after it
+func (h *tMixHandler) wrap(ctx *Context, next func(*Context)) {
+	inst := h.factory.get(ctx)
+	defer h.factory.put(inst)
+	if m, ok := inst.middleware.(*tHTTPMiddleware); ok {
+		m.serve(ctx, next)
+	} else {
+		inst.wrapper.Wrap(func() {
+			next(ctx)
+		})
+	}
+}
+
+// compile returns a function doing the same as call, the type of handler is checked only once
+func (h *tMixHandler) compile() func(*Context) bool {
+	switch h.hType {
+	case cHTYPE_HTTP_HANDLER:
+		handler := h.httpHandler
+		return func(ctx *Context) bool {
+			handler.ServeHTTP(ctx.Rsp, ctx.Req)
+			return true
+		}
+	case cHTYPE_IAFON_HANDLER:
+		handler := h.iafonHandler
+		return func(ctx *Context) bool {
+			handler.Handle(ctx)
+			return true
+		}
+	case cHTYPE_MIDDLEWARE:
+		factory := h.factory
+		return func(ctx *Context) bool {
+			inst := factory.get(ctx)
+			defer factory.put(inst)
+			return inst.middleware.Handle()
+		}
+	default:
+		return h.call
+	}
+}
@@ -0,0 +1,139 @@
+package iafon
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// mountParam is the catch-all param of path under the prefix of Mount, it is shown as "*", see hideMountParam
+const mountParam = "_mount_path"
+
+// hideMountParam returns pattern with the catch-all param of Mount shown as "*", like "/legacy/*",
+// patterns of routes are shown by it in GetRoutes, exports, OpenAPI document and reports
+func hideMountParam(pattern string) string {
+	if strings.HasSuffix(pattern, "*"+mountParam) {
+		return pattern[:len(pattern)-len(mountParam)]
+	}
+	return pattern
+}
+
+// isMount reports whether rn is the route added by Mount
+func (rn *RouteNode) isMount() bool {
+	return strings.HasSuffix(rn.pattern, "*"+mountParam)
+}
+
+// tMountParamsKey is the key of request context for params of the mount prefix, passed to the router mounted
+type tMountParamsKey struct{}
+
+// NewRouter creates a Router to be mounted by RouteGroup.Mount, or used as http.Handler
+func NewRouter() *Router {
+	return newRouter()
+}
+
+// Mount forwards requests of any method under prefix to handler, prefix is stripped from URL.Path of request,
+// so "/legacy/a/b" mounted at "/legacy" is forwarded as "/a/b", and "/legacy" is forwarded as "/".
+// handler could be another Router or Server, which keeps its middlewares and error handlers,
+// params of prefix like "/tenant/:tid" are passed to its context, and it is frozen with this router.
+func (g *RouteGroup) Mount(prefix string, handler http.Handler) *RouteNode {
+	if handler == nil {
+		panic("http: nil handler")
+	}
+
+	var sub *Router
+	switch h := handler.(type) {
+	case *Router:
+		sub = h
+	case *Server:
+		sub = h.Router
+	}
+
+	if sub != nil {
+		if sub.mounts(g.router) {
+			panic("route: router could not be mounted to itself")
+		}
+		sub.mounted = true
+	}
+
+	rn := g.handleUnder("*", prefix, mountParam, func(c *Context) {
+		c.forward(handler, sub != nil)
+	})
+
+	if sub != nil {
+		g.router.mu.Lock()
+		g.router.mountedRouters = append(g.router.mountedRouters, sub)
+		g.router.mu.Unlock()
+	}
+
+	return rn
+}
+
+// handleUnder adds route of method for paths under prefix, the path under prefix is the catch-all param.
+// prefix itself is added as alias, like "/static" for "/static/*filepath".
+func (g *RouteGroup) handleUnder(method, prefix, param string, handler interface{}) *RouteNode {
+	prefix = strings.TrimRight(prefix, "/")
+
+	pattern := prefix + "/*" + param
+	if prefix == "" && strings.HasSuffix(g.prefix, "/") {
+		pattern = "*" + param
+	}
+
+	rn := g.Handle(method, pattern, handler)
+
+	if full := g.prefix + prefix; strings.IndexByte(full, '/') >= 0 && !strings.HasSuffix(full, "/") {
+		rn.Alias(prefix)
+	}
+
+	return rn
+}
+
+// mounts reports whether r is target or target is mounted by r, directly or not
+func (r *Router) mounts(target *Router) bool {
+	if r == target {
+		return true
+	}
+	for _, sub := range r.mountedRouters {
+		if sub.mounts(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// forward serves request by handler with the mount prefix stripped, see RouteGroup.Mount.
+// if passParams, params other than the mount path are passed by request context.
+func (c *Context) forward(handler http.Handler, passParams bool) {
+	rest := "/" + c.Param[mountParam]
+
+	req := new(http.Request)
+	*req = *c.Req
+	req.URL = new(url.URL)
+	*req.URL = *c.Req.URL
+
+	prefix := strings.TrimSuffix(c.Req.URL.Path, rest)
+	req.URL.Path = rest
+
+	// the same as http.StripPrefix
+	if req.URL.RawPath != "" {
+		if raw_path := strings.TrimPrefix(req.URL.RawPath, prefix); raw_path != req.URL.RawPath && raw_path != "" {
+			req.URL.RawPath = raw_path
+		} else {
+			req.URL.RawPath = ""
+		}
+	}
+
+	if passParams {
+		var ps Params
+		for _, p := range c.Params {
+			if p.Key != mountParam {
+				ps = append(ps, p)
+			}
+		}
+		if len(ps) > 0 {
+			req = req.WithContext(context.WithValue(req.Context(), tMountParamsKey{}, ps))
+		}
+	}
+
+	handler.ServeHTTP(c.Rsp, req)
+}
@@ -0,0 +1,121 @@
+package iafon
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMountHandler(t *testing.T) {
+	var echo string
+
+	legacy := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		echo = req.Method + " " + req.URL.Path + " " + req.URL.RawPath
+	})
+
+	r := newRouter()
+	r.GET("/legacy/own", func(c *Context) { echo = "own" })
+	r.Mount("/legacy/", legacy)
+	r.Group("/api/").Mount("", legacy)
+
+	var tests = []struct {
+		method, url string
+		expected    string
+	}{
+		{"GET", "/legacy/a/b", "GET /a/b "},
+		{"POST", "/legacy/a/", "POST /a/ "},
+		{"GET", "/legacy", "GET / "},
+		{"GET", "/legacy/", "GET / "},
+		{"GET", "/legacy/a%2Fb/c", "GET /a/b/c /a%2Fb/c"},
+		{"GET", "/legacy/own", "own"},
+		{"PUT", "/api/v1", "PUT /v1 "},
+	}
+
+	for _, test := range tests {
+		echo = ""
+		req, _ := http.NewRequest(test.method, "http://localhost"+test.url, nil)
+		r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+		if echo != test.expected {
+			t.Fatalf("mount error. req: %s %s, expected: '%s', got: '%s'", test.method, test.url, test.expected, echo)
+		}
+	}
+}
+
+func TestMountRouter(t *testing.T) {
+	var echo string
+
+	billing := NewRouter()
+	billing.UseMiddleware(&TestMiddleware{})
+	billing.GET("/invoice/:id", func(c *Context) {
+		echo = "invoice " + c.Param["tid"] + " " + c.Param["id"]
+	})
+	billing.HandleError(404, func(c *Context) {
+		echo = "billing 404"
+	})
+
+	r := newRouter()
+	r.Mount("/tenant/:tid/billing", billing)
+
+	middleware_test_echo = ""
+	req, _ := http.NewRequest("GET", "http://localhost/tenant/acme/billing/invoice/42", nil)
+	r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+	if echo != "invoice acme 42" {
+		t.Fatal("mounted router should get params of prefix, got:", echo)
+	}
+	if middleware_test_echo != "/invoice/42" {
+		t.Fatal("middleware of mounted router should get the stripped path, got:", middleware_test_echo)
+	}
+
+	req, _ = http.NewRequest("GET", "http://localhost/tenant/acme/billing/none", nil)
+	r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+	if echo != "billing 404" {
+		t.Fatal("mounted router should use its error handler, got:", echo)
+	}
+
+	if err := r.Freeze(); err != nil {
+		t.Fatal(err)
+	}
+	if !billing.isFrozen() {
+		t.Fatal("mounted router should be frozen with the router mounting it")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("mounting router to itself should panic")
+		}
+	}()
+	r2 := NewRouter()
+	billing2 := NewRouter()
+	r2.Mount("/billing", billing2)
+	billing2.Mount("/main", r2)
+}
+
+func TestMountPatternShown(t *testing.T) {
+	r := newRouter()
+	r.Mount("/legacy", http.NotFoundHandler())
+	r.GET("/user/:id", func(*Context) {})
+
+	outputs := map[string]string{
+		"String":   r.GetRoutes().String(),
+		"DOT":      r.RouteTree().DOT(),
+		"Explain":  r.Explain("GET", "localhost", "/legacy/a").String(),
+		"Validate": r.Validate().String(),
+	}
+	data, _ := r.GetRoutes().JSON()
+	outputs["JSON"] = string(data)
+	data, _ = r.OpenAPI(OpenAPIInfo{}).JSON()
+	outputs["OpenAPI"] = string(data)
+
+	for name, output := range outputs {
+		if strings.Contains(output, mountParam) {
+			t.Fatalf("catch-all param of Mount should not be shown by %s, got:\n%s", name, output)
+		}
+	}
+
+	if !strings.Contains(outputs["String"], "/legacy/*\n") || r.GetRoutes()[0].Pattern() != "/legacy/*" {
+		t.Fatal("route of Mount should be shown as /legacy/*, got:", outputs["String"])
+	}
+	if strings.Contains(outputs["OpenAPI"], "/legacy") {
+		t.Fatal("route of Mount should not be in OpenAPI document")
+	}
+}
@@ -0,0 +1,678 @@
+package iafon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metadata keys read by Router.OpenAPI, see RouteNode.SetMeta.
+// other metadata of route is added to operation as extension "x-<key>".
+const (
+	MetaSummary     = "summary"
+	MetaDescription = "description"
+	// []string
+	MetaTags = "tags"
+	// true, or the deprecation date
+	MetaDeprecated = "deprecated"
+	// value of request body type, like CreateUser{}, its JSON schema is generated by reflection.
+	// handlers are not typed, so request and response types are known only by metadata.
+	MetaRequest = "request"
+	// value of response body type, like []User{}, its JSON schema is generated by reflection
+	MetaResponse = "response"
+	// true to exclude route from OpenAPI document
+	MetaHidden = "hidden"
+)
+
+// OpenAPIInfo is the info object of OpenAPI document
+type OpenAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// OpenAPIDocument is an OpenAPI 3.1 document generated by Router.OpenAPI, see JSON and YAML
+type OpenAPIDocument struct {
+	doc map[string]interface{}
+}
+
+// methods of OpenAPI path item, routes of other methods are not in document
+var openapi_methods = []string{"GET", "PUT", "POST", "DELETE", "OPTIONS", "HEAD", "PATCH", "TRACE"}
+
+// OpenAPI generates OpenAPI 3.1 document of routes.
+// params in pattern are path parameters, conditions of query and header are parameters too,
+// metadata of route like summary and tags is added to operation, see MetaSummary.
+// request and response schemas are generated only from types in metadata MetaRequest and MetaResponse.
+// routes of the same path and method with different conditions are merged into one operation,
+// their parameters are optional unless required by all of them, their media types are merged and
+// different schemas of the same media type are merged by oneOf, see mergeOperation.
+// paths differing only by names of params, like /user/:id and /user/:name, are the same path in OpenAPI,
+// they are merged into the path added first, params are renamed by position.
+// routes added by Mount are not in document, a mounted router could serve its own document.
+func (r *Router) OpenAPI(info OpenAPIInfo) *OpenAPIDocument {
+	g := &tSchemaGenerator{schemas: make(map[string]interface{}), names: make(map[reflect.Type]string)}
+
+	paths := make(map[string]interface{})
+	// the first path and its params by path with params unnamed, like /user/{}
+	templates := make(map[string][]interface{})
+	template_paths := make(map[string]string)
+	operation_ids := make(map[string]bool)
+	// host of operation by path and method
+	op_hosts := make(map[string]string)
+
+	for _, rn := range r.GetRoutes() {
+		// paths under the prefix of Mount could not be described
+		if hidden, _ := rn.load().meta[MetaHidden].(bool); hidden || rn.isMount() {
+			continue
+		}
+
+		methods := []string{rn.method}
+		if rn.method == "*" {
+			methods = openapi_methods
+		}
+
+		for _, pattern := range rn.load().patterns {
+			host, path := splitHostPattern(pattern)
+			openapi_path, template, params := openAPIPath(path)
+			if first, ok := template_paths[template]; ok && first != openapi_path {
+				openapi_path = first
+				for i, p := range params {
+					p.(map[string]interface{})["name"] = templates[template][i].(map[string]interface{})["name"]
+				}
+			} else if !ok {
+				template_paths[template] = openapi_path
+				templates[template] = params
+			}
+
+			item, _ := paths[openapi_path].(map[string]interface{})
+			if item == nil {
+				item = make(map[string]interface{})
+				paths[openapi_path] = item
+			}
+
+			for _, method := range methods {
+				key := strings.ToLower(method)
+				if !isOpenAPIMethod(method) {
+					continue
+				}
+
+				op_key := openapi_path + " " + key
+				if prev, ok := item[key].(map[string]interface{}); ok {
+					// routes of other hosts are not added, routes without host are sorted first
+					if op_hosts[op_key] == host {
+						item[key] = mergeOperation(prev, g.operation(rn, method, params))
+					}
+					continue
+				}
+
+				op := g.operation(rn, method, params)
+				op["operationId"] = uniqueOperationId(operation_ids, rn, method, openapi_path)
+				if host != "" {
+					op["x-host"] = host
+				}
+				item[key] = op
+				op_hosts[op_key] = host
+			}
+
+			if len(item) == 0 {
+				delete(paths, openapi_path)
+			}
+		}
+	}
+
+	if info.Title == "" {
+		info.Title = "API"
+	}
+	if info.Version == "" {
+		info.Version = "1.0.0"
+	}
+
+	info_obj := map[string]interface{}{"title": info.Title, "version": info.Version}
+	if info.Description != "" {
+		info_obj["description"] = info.Description
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info":    info_obj,
+		"paths":   paths,
+	}
+	if len(g.schemas) > 0 {
+		doc["components"] = map[string]interface{}{"schemas": g.schemas}
+	}
+
+	return &OpenAPIDocument{doc: doc}
+}
+
+// JSON returns document as indented JSON, it fails if metadata of route could not be marshaled
+func (d *OpenAPIDocument) JSON() ([]byte, error) {
+	return json.MarshalIndent(d.doc, "", "  ")
+}
+
+// YAML returns document as YAML, it is converted from JSON, so it fails in the same case as JSON
+func (d *OpenAPIDocument) YAML() ([]byte, error) {
+	data, err := json.Marshal(d.doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// values of metadata are converted to what JSON has
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	writeYAMLMap(&b, doc, "", "")
+	return []byte(b.String()), nil
+}
+
+// writeYAMLMap writes m as YAML block mapping at indent, the first key is written after first instead of indent
+func writeYAMLMap(b *strings.Builder, m map[string]interface{}, indent, first string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for i, k := range keys {
+		if i == 0 {
+			b.WriteString(first)
+		} else {
+			b.WriteString(indent)
+		}
+		b.WriteString(yamlString(k) + ":")
+		writeYAMLValue(b, m[k], indent+"  ")
+	}
+}
+
+// writeYAMLValue writes v after the key or "-" of it, collections are written as blocks at indent
+func writeYAMLValue(b *strings.Builder, v interface{}, indent string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			b.WriteString(" {}\n")
+			return
+		}
+		b.WriteString("\n")
+		writeYAMLMap(b, v, indent, indent)
+	case []interface{}:
+		if len(v) == 0 {
+			b.WriteString(" []\n")
+			return
+		}
+		b.WriteString("\n")
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok && len(m) > 0 {
+				writeYAMLMap(b, m, indent+"  ", indent+"- ")
+				continue
+			}
+			b.WriteString(indent + "-")
+			writeYAMLValue(b, item, indent+"  ")
+		}
+	case string:
+		b.WriteString(" " + yamlString(v) + "\n")
+	case json.Number:
+		b.WriteString(" " + v.String() + "\n")
+	case bool:
+		b.WriteString(" " + strconv.FormatBool(v) + "\n")
+	default:
+		b.WriteString(" null\n")
+	}
+}
+
+// yamlString returns s as plain scalar if it could not be read as other type or syntax of YAML, or quoted
+func yamlString(s string) string {
+	switch strings.ToLower(s) {
+	case "", "true", "false", "yes", "no", "on", "off", "y", "n", "null", "~":
+		return strconv.Quote(s)
+	}
+
+	for i, c := range s {
+		plain := ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c == '_' || c == '/' ||
+			(i > 0 && (('0' <= c && c <= '9') || c == '-' || c == '.' || c == '{' || c == '}' || c == ' '))
+		if !plain {
+			return strconv.Quote(s)
+		}
+	}
+	if strings.HasSuffix(s, " ") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// ServeOpenAPI serves OpenAPI document of routes at path, as YAML if path ends with ".yaml" or ".yml",
+// or as JSON. the route is not in the document.
+func (r *Router) ServeOpenAPI(path string, info OpenAPIInfo) *RouteNode {
+	as_yaml := strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
+
+	return r.GET(path, func(c *Context) {
+		var data []byte
+		var err error
+		content_type := "application/json"
+		if as_yaml {
+			data, err = r.OpenAPI(info).YAML()
+			content_type = "application/yaml"
+		} else {
+			data, err = r.OpenAPI(info).JSON()
+		}
+		if err != nil {
+			panic("http: fail to generate OpenAPI document, " + err.Error())
+		}
+		c.Rsp.Header().Set("Content-Type", content_type)
+		c.Rsp.Write(data)
+	}).SetMeta(MetaHidden, true)
+}
+
+func isOpenAPIMethod(method string) bool {
+	for _, m := range openapi_methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// openAPIPath converts ":param" and "*catch_all" in path to "{param}", and returns path parameters.
+// template is the path with params unnamed, like "/user/{}".
+func openAPIPath(path string) (openapi_path, template string, params []interface{}) {
+	var b, tb strings.Builder
+
+	for _, part := range newMapItem(path, true).parts {
+		if part.pType == cSubPatternStatic {
+			b.WriteString(part.text)
+			tb.WriteString(part.text)
+			continue
+		}
+
+		b.WriteString("{" + part.text + "}")
+		tb.WriteString("{}")
+
+		param := map[string]interface{}{
+			"name":     part.text,
+			"in":       "path",
+			"required": true,
+			"schema":   constraintSchema(part),
+		}
+		if part.pType == cSubPatternCatchAll {
+			param["description"] = "the rest of path, which may contain /"
+		}
+		params = append(params, param)
+	}
+
+	return b.String(), tb.String(), params
+}
+
+// constraintSchema returns JSON schema of param constraint
+func constraintSchema(part tSubPattern) map[string]interface{} {
+	switch {
+	case part.re == nil:
+		return map[string]interface{}{"type": "string"}
+	case part.constraint == "int":
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case part.constraint == "uuid":
+		return map[string]interface{}{"type": "string", "format": "uuid"}
+	default:
+		return map[string]interface{}{"type": "string", "pattern": part.re.String()}
+	}
+}
+
+// operation returns operation object of rn for method
+func (g *tSchemaGenerator) operation(rn *RouteNode, method string, path_params []interface{}) map[string]interface{} {
+	op := make(map[string]interface{})
+
+	params := append([]interface{}(nil), path_params...)
+	request_types := []string{"application/json"}
+	response_types := []string{"application/json"}
+
+	for _, c := range rn.load().conditions {
+		switch c.kind {
+		case cConditionQuery, cConditionHeader:
+			in := "query"
+			if c.kind == cConditionHeader {
+				in = "header"
+			}
+			schema := map[string]interface{}{"type": "string"}
+			if c.values[0] != "" {
+				schema["const"] = c.values[0]
+			}
+			params = append(params, map[string]interface{}{"name": c.key, "in": in, "required": true, "schema": schema})
+		case cConditionContentType:
+			request_types = c.values
+		case cConditionAccept:
+			response_types = c.values
+		}
+	}
+
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	for key, value := range rn.load().meta {
+		switch key {
+		case MetaSummary, MetaDescription, MetaTags:
+			op[key] = value
+		case MetaDeprecated:
+			if deprecated, ok := value.(bool); ok {
+				op["deprecated"] = deprecated
+			} else {
+				op["deprecated"] = true
+				op["x-deprecated"] = value
+			}
+		case MetaRequest, MetaResponse, MetaHidden:
+		default:
+			op["x-"+key] = value
+		}
+	}
+
+	if v, ok := rn.load().meta[MetaRequest]; ok && v != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  mediaContent(request_types, g.schema(reflect.TypeOf(v))),
+		}
+	}
+
+	response := map[string]interface{}{"description": http.StatusText(http.StatusOK)}
+	if v, ok := rn.load().meta[MetaResponse]; ok && v != nil {
+		response["content"] = mediaContent(response_types, g.schema(reflect.TypeOf(v)))
+	}
+	op["responses"] = map[string]interface{}{"200": response}
+
+	return op
+}
+
+// mergeOperation merges operation b of a route into a, both of the same path and method with different conditions.
+// metadata of a is kept, b adds what a does not have, and it is deprecated only if both are deprecated.
+func mergeOperation(a, b map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		merged[k] = v
+	}
+	for k, v := range b {
+		if _, ok := merged[k]; !ok && k != "deprecated" {
+			merged[k] = v
+		}
+	}
+
+	if a["deprecated"] != true || b["deprecated"] != true {
+		delete(merged, "deprecated")
+		delete(merged, "x-deprecated")
+	}
+
+	a_params, _ := a["parameters"].([]interface{})
+	b_params, _ := b["parameters"].([]interface{})
+	if params := mergeParameters(a_params, b_params); len(params) > 0 {
+		merged["parameters"] = params
+	}
+
+	a_body, a_ok := a["requestBody"].(map[string]interface{})
+	b_body, b_ok := b["requestBody"].(map[string]interface{})
+	if a_ok && b_ok {
+		merged["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  mergeContent(a_body["content"], b_body["content"]),
+		}
+	} else if a_ok || b_ok {
+		// body is not required by the route without request type
+		body := a_body
+		if !a_ok {
+			body = b_body
+		}
+		merged["requestBody"] = map[string]interface{}{"required": false, "content": body["content"]}
+	}
+
+	a_rsp := a["responses"].(map[string]interface{})["200"].(map[string]interface{})
+	b_rsp := b["responses"].(map[string]interface{})["200"].(map[string]interface{})
+	response := map[string]interface{}{"description": a_rsp["description"]}
+	if content := mergeContent(a_rsp["content"], b_rsp["content"]); len(content) > 0 {
+		response["content"] = content
+	}
+	merged["responses"] = map[string]interface{}{"200": response}
+
+	return merged
+}
+
+// mergeParameters returns parameters of a and b, parameters not in both are optional,
+// values of query or header conditions are merged by enum
+func mergeParameters(a, b []interface{}) []interface{} {
+	find := func(params []interface{}, p map[string]interface{}) map[string]interface{} {
+		for _, v := range params {
+			if q := v.(map[string]interface{}); q["name"] == p["name"] && q["in"] == p["in"] {
+				return q
+			}
+		}
+		return nil
+	}
+
+	var merged []interface{}
+	for _, v := range a {
+		p := copyMeta(v.(map[string]interface{}), "", nil)
+		if other := find(b, p); other == nil {
+			p["required"] = false
+		} else if !reflect.DeepEqual(p["schema"], other["schema"]) {
+			p["schema"] = mergeParameterSchema(p["schema"].(map[string]interface{}), other["schema"].(map[string]interface{}))
+		}
+		merged = append(merged, p)
+	}
+	for _, v := range b {
+		if find(a, v.(map[string]interface{})) == nil {
+			merged = append(merged, copyMeta(v.(map[string]interface{}), "required", false))
+		}
+	}
+	return merged
+}
+
+// mergeParameterSchema returns schema of values of both a and b, which are schemas of conditions
+func mergeParameterSchema(a, b map[string]interface{}) map[string]interface{} {
+	var values []string
+	for _, schema := range [2]map[string]interface{}{a, b} {
+		switch {
+		case schema["const"] != nil:
+			values = append(values, schema["const"].(string))
+		case schema["enum"] != nil:
+			values = append(values, schema["enum"].([]string)...)
+		default:
+			// any value
+			return map[string]interface{}{"type": "string"}
+		}
+	}
+
+	sort.Strings(values)
+	enum := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			enum = append(enum, v)
+		}
+	}
+	return map[string]interface{}{"type": "string", "enum": enum}
+}
+
+// mergeContent returns media types of both a and b, different schemas of the same media type are merged by oneOf
+func mergeContent(a, b interface{}) map[string]interface{} {
+	merged := make(map[string]interface{})
+	for _, content := range [2]interface{}{a, b} {
+		content, _ := content.(map[string]interface{})
+		for media_type, v := range content {
+			schema := v.(map[string]interface{})["schema"]
+
+			prev, ok := merged[media_type].(map[string]interface{})
+			if !ok {
+				merged[media_type] = map[string]interface{}{"schema": schema}
+				continue
+			}
+
+			prev_schema := prev["schema"].(map[string]interface{})
+			one_of, ok := prev_schema["oneOf"].([]interface{})
+			if !ok {
+				one_of = []interface{}{prev_schema}
+			}
+			for _, s := range one_of {
+				if reflect.DeepEqual(s, schema) {
+					schema = nil
+					break
+				}
+			}
+			if schema != nil {
+				merged[media_type] = map[string]interface{}{"schema": map[string]interface{}{"oneOf": append(one_of, schema)}}
+			}
+		}
+	}
+	return merged
+}
+
+func mediaContent(media_types []string, schema interface{}) map[string]interface{} {
+	content := make(map[string]interface{}, len(media_types))
+	for _, t := range media_types {
+		content[t] = map[string]interface{}{"schema": schema}
+	}
+	return content
+}
+
+// uniqueOperationId returns name of rn, or an id generated by method and path, like "get_user_id"
+func uniqueOperationId(ids map[string]bool, rn *RouteNode, method, path string) string {
+	id := rn.name
+	if id == "" || rn.method == "*" {
+		var b strings.Builder
+		b.WriteString(strings.ToLower(method))
+		for _, c := range path {
+			if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+				b.WriteRune(c)
+			} else if s := b.String(); s[len(s)-1] != '_' {
+				b.WriteByte('_')
+			}
+		}
+		id = strings.TrimSuffix(b.String(), "_")
+	}
+
+	unique := id
+	for i := 2; ids[unique]; i++ {
+		unique = id + "_" + strconv.Itoa(i)
+	}
+	ids[unique] = true
+
+	return unique
+}
+
+// tSchemaGenerator generates JSON schema of types by reflection, named struct types are in components
+type tSchemaGenerator struct {
+	schemas map[string]interface{}
+	names   map[reflect.Type]string
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *tSchemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + g.structName(t)}
+	default:
+		// any value
+		return map[string]interface{}{}
+	}
+}
+
+// structName returns name of struct type in components, its schema is generated once
+func (g *tSchemaGenerator) structName(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	for i := 2; g.schemas[name] != nil; i++ {
+		name = t.Name() + strconv.Itoa(i)
+	}
+
+	// set before generating, for types referring to itself
+	g.names[t] = name
+	g.schemas[name] = map[string]interface{}{}
+	g.schemas[name] = g.structSchema(t)
+
+	return name
+}
+
+// structSchema returns schema of struct fields, by the same rules of encoding/json
+func (g *tSchemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options := tag, ""
+			if pos := strings.IndexByte(tag, ','); pos >= 0 {
+				name, options = tag[:pos], tag[pos:]
+			}
+
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			// fields of embedded struct are promoted
+			if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				add(ft)
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = g.schema(f.Type)
+
+			if !strings.Contains(options, ",omitempty") && f.Type.Kind() != reflect.Ptr {
+				required = append(required, name)
+			}
+		}
+	}
+	add(t)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,169 @@
+package iafon
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update_golden = flag.Bool("update", false, "update golden files of testdata")
+
+type openAPITestUser struct {
+	Id      int       `json:"id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email,omitempty"`
+	Created time.Time `json:"created"`
+	Friends []*openAPITestUser
+	secret  string
+}
+
+type openAPITestCreateUser struct {
+	Name  string            `json:"name"`
+	Tags  map[string]string `json:"tags,omitempty"`
+	Token string            `json:"-"`
+}
+
+func openAPITestRouter() *Router {
+	var handler = func(*Context) {}
+
+	r := newRouter()
+	r.GET("/user/:id<int>", handler).Name("getUser").
+		SetMeta(MetaSummary, "get user").
+		SetMeta(MetaTags, []string{"user"}).
+		SetMeta(MetaResponse, openAPITestUser{})
+	r.POST("/user", handler).When(MatchContentType("application/json")).
+		SetMeta(MetaRequest, openAPITestCreateUser{}).
+		SetMeta(MetaResponse, &openAPITestUser{}).
+		SetMeta("perm", "user.create")
+	r.GET("/user", handler).When(MatchQuery("format", "csv")).SetMeta(MetaDeprecated, "2026-01-01")
+	// routes of the same path and method are merged
+	r.GET("/user", handler).SetMeta(MetaSummary, "list users").SetMeta(MetaResponse, []openAPITestUser{})
+	r.GET("/user", handler, MatchHeader("X-Api-Version", "2")).SetMeta(MetaResponse, map[string]openAPITestUser{})
+	r.GET("/files/*filepath", handler)
+	r.Handle("*", "/ping", handler)
+	r.GET("/internal", handler).SetMeta(MetaHidden, true)
+	r.Group("api.example.com").GET("/status", handler)
+	r.ServeOpenAPI("/openapi.json", OpenAPIInfo{Title: "test"})
+
+	return r
+}
+
+func TestOpenAPI(t *testing.T) {
+	doc := openAPITestRouter().OpenAPI(OpenAPIInfo{Title: "test", Version: "1.0.0"})
+
+	for golden, encode := range map[string]func() ([]byte, error){
+		"testdata/openapi.golden.json": doc.JSON,
+		"testdata/openapi.golden.yaml": doc.YAML,
+	} {
+		data, err := encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if *update_golden {
+			if err := os.WriteFile(golden, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("OpenAPI document differs from %s, run tests with -update if it is expected, got:\n%s", golden, data)
+		}
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	r := openAPITestRouter()
+
+	req, _ := http.NewRequest("GET", "http://localhost/openapi.json", nil)
+	w := &MockResponseWriter{header: http.Header{}}
+	r.ServeHTTP(w, req)
+
+	if w.header.Get("Content-Type") != "application/json" || !strings.Contains(w.data, `"openapi": "3.1.0"`) {
+		t.Fatal("OpenAPI document should be served, got:", w.data)
+	}
+	if strings.Contains(w.data, "/openapi.json") || strings.Contains(w.data, "/internal") {
+		t.Fatal("hidden routes should not be in OpenAPI document")
+	}
+}
+
+func TestServeOpenAPIYAML(t *testing.T) {
+	r := openAPITestRouter()
+	r.ServeOpenAPI("/openapi.yaml", OpenAPIInfo{Title: "test"})
+
+	req, _ := http.NewRequest("GET", "http://localhost/openapi.yaml", nil)
+	w := &MockResponseWriter{header: http.Header{}}
+	r.ServeHTTP(w, req)
+
+	if w.header.Get("Content-Type") != "application/yaml" || !strings.HasPrefix(w.data, "components:\n") ||
+		!strings.Contains(w.data, "\nopenapi: \"3.1.0\"\n") {
+		t.Fatal("OpenAPI document should be served as YAML, got:", w.data)
+	}
+}
+
+func TestOpenAPIPathsOfParamNames(t *testing.T) {
+	r := newRouter()
+	r.GET("/user/:id", func(*Context) {})
+	r.DELETE("/user/:name", func(*Context) {})
+	r.GET("/user/:name/posts", func(*Context) {})
+
+	paths := r.OpenAPI(OpenAPIInfo{}).doc["paths"].(map[string]interface{})
+	if len(paths) != 2 || paths["/user/{name}"] != nil {
+		t.Fatal("paths differing only by names of params should be merged, got:", paths)
+	}
+
+	op := paths["/user/{id}"].(map[string]interface{})["delete"].(map[string]interface{})
+	if name := op["parameters"].([]interface{})[0].(map[string]interface{})["name"]; name != "id" {
+		t.Fatal("params of merged path should be renamed, got:", name)
+	}
+}
+
+func TestYAMLString(t *testing.T) {
+	var tests = []struct {
+		s, expected string
+	}{
+		{"get user", "get user"},
+		{"/user/{id}", "/user/{id}"},
+		{"3.1.0", `"3.1.0"`},
+		{"200", `"200"`},
+		{"true", `"true"`},
+		{"No", `"No"`},
+		{"", `""`},
+		{"a: b", `"a: b"`},
+		{"#tag", `"#tag"`},
+		{"line\nbreak", `"line\nbreak"`},
+	}
+
+	for _, test := range tests {
+		if got := yamlString(test.s); got != test.expected {
+			t.Fatalf("yamlString(%q), expected: %s, got: %s", test.s, test.expected, got)
+		}
+	}
+}
+
+func TestOpenAPIMergeParameters(t *testing.T) {
+	r := newRouter()
+	r.GET("/report", func(*Context) {}, MatchQuery("format", "csv"))
+	r.GET("/report", func(*Context) {}, MatchQuery("format", "pdf"))
+
+	doc := r.OpenAPI(OpenAPIInfo{})
+	op := doc.doc["paths"].(map[string]interface{})["/report"].(map[string]interface{})["get"].(map[string]interface{})
+	params := op["parameters"].([]interface{})
+	if len(params) != 1 {
+		t.Fatal("parameters of routes should be merged, got:", params)
+	}
+
+	p := params[0].(map[string]interface{})
+	enum, _ := p["schema"].(map[string]interface{})["enum"].([]string)
+	if p["required"] != true || len(enum) != 2 || enum[0] != "csv" || enum[1] != "pdf" {
+		t.Fatal("values of query conditions should be merged by enum, got:", p)
+	}
+}
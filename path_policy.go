@@ -0,0 +1,117 @@
+package iafon
+
+import (
+	"net/http"
+	"strings"
+)
+
+// PathAction is how Router handles request path which does not match route pattern exactly
+type PathAction byte
+
+const (
+	// the default action of each kind of mismatch, see PathPolicy
+	PathDefault PathAction = iota
+	// redirect to the path matching route pattern exactly
+	PathRedirect
+	// serve request by the route matched, without redirect
+	PathServe
+	// reply 404, as if no route is matched
+	PathNotFound
+)
+
+// PathPolicy decides how Router handles request path which does not match route pattern exactly.
+// if path has several kinds of mismatch, PathNotFound takes precedence over PathRedirect, then PathServe.
+type PathPolicy struct {
+	// path without trailing slash of pattern, like "/user" for "/user/", redirect by default
+	TrailingSlash PathAction
+
+	// path with trailing slash not in pattern, like "/user/" for "/user",
+	// served by default, because pattern matches path as a prefix
+	ExtraTrailingSlash PathAction
+
+	// path with duplicate slashes, like "/user//42", redirect by default
+	DuplicateSlash PathAction
+
+	// path with dot segments, like "/user/./42" or "/user/x/../42", redirect by default
+	DotSegment PathAction
+
+	// status code of redirect for GET and HEAD requests, default is 307
+	RedirectCode int
+
+	// status code of redirect for other methods, default is 307.
+	// 308 makes clients keep method and body permanently.
+	RedirectCodeOther int
+}
+
+// severity of action, the most severe action wins
+func (a PathAction) severity() int {
+	switch a {
+	case PathServe:
+		return 0
+	case PathRedirect:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// action returns how to handle raw_path, whose cleaned path is path.
+// missingSlash or extraSlash is true if path does not match the trailing slash of pattern.
+func (p *PathPolicy) action(raw_path, path string, missingSlash, extraSlash bool) PathAction {
+	action := PathServe
+
+	apply := func(a, default_action PathAction) {
+		if a == PathDefault {
+			a = default_action
+		}
+		if a.severity() > action.severity() {
+			action = a
+		}
+	}
+
+	if missingSlash {
+		apply(p.TrailingSlash, PathRedirect)
+	}
+	if extraSlash {
+		apply(p.ExtraTrailingSlash, PathServe)
+	}
+
+	if raw_path != path {
+		duplicate := strings.Contains(raw_path, "//")
+		dot := hasDotSegment(raw_path)
+
+		if duplicate {
+			apply(p.DuplicateSlash, PathRedirect)
+		}
+		if dot {
+			apply(p.DotSegment, PathRedirect)
+		}
+		if !duplicate && !dot {
+			// path not starting with '/', always redirect
+			apply(PathRedirect, PathRedirect)
+		}
+	}
+
+	return action
+}
+
+func (p *PathPolicy) redirectCode(method string) int {
+	code := p.RedirectCodeOther
+	if method == "GET" || method == "HEAD" {
+		code = p.RedirectCode
+	}
+	if code == 0 {
+		code = http.StatusTemporaryRedirect
+	}
+	return code
+}
+
+// hasDotSegment reports whether path has segment "." or ".."
+func hasDotSegment(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
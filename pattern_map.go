@@ -1,9 +1,202 @@
 package iafon
 
-// tPatternMapInterface is just for comment, not used in code
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PatternMapInterface is the matcher used by Router, see Router.SetMatcher.
+// PatternMapByTree is used by default, PatternMapByList uses less memory for a few routes.
+// Router uses PatternMapParamsInterface and PatternMapCloneInterface if matcher implements them.
 type PatternMapInterface interface {
+	// Set panics if pattern is invalid
 	Set(pattern string, value interface{})
 	Get(pattern string) interface{}
+	// Match returns value of the pattern matching str, and params matched.
+	// redirect is true if str matches pattern without the trailing slash of pattern.
+	// substr is the matched prefix of str, it is str without the trailing slash if
+	// str matches pattern with an extra trailing slash.
 	Match(str string) (value interface{}, params map[string]string, redirect bool, substr string)
 	Len() int
 }
+
+// PatternMapParamsInterface is implemented by matcher which matches params without making a map
+type PatternMapParamsInterface interface {
+	// MatchParams matches path like Match, matched params are appended to *ps in the order of pattern
+	MatchParams(path string, ps *Params) (value interface{}, redirect bool, substr string)
+}
+
+// PatternMapCloneInterface is implemented by matcher which could be copied.
+// routes of matcher not implementing it are modified in place, so they should not be changed while serving,
+// and they could not be removed.
+type PatternMapCloneInterface interface {
+	// Delete removes pattern, reports whether pattern is found
+	Delete(pattern string) bool
+	// Clone returns a copy, modifying the copy does not affect the original,
+	// so the original could be matching paths while the copy is modified
+	Clone() PatternMapInterface
+}
+
+// matchParams matches path by m, params are appended to *ps.
+// params of matcher without MatchParams are appended in the order of name.
+func matchParams(m PatternMapInterface, path string, ps *Params) (value interface{}, redirect bool, substr string) {
+	if pm, ok := m.(PatternMapParamsInterface); ok {
+		return pm.MatchParams(path, ps)
+	}
+
+	value, params, redirect, substr := m.Match(path)
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		*ps = append(*ps, Param{Key: k, Value: params[k]})
+	}
+	return
+}
+
+// matchMap implements Match by MatchParams of m
+func matchMap(m PatternMapParamsInterface, path string) (value interface{}, params map[string]string, redirect bool, substr string) {
+	var ps Params
+	value, redirect, substr = m.MatchParams(path, &ps)
+	if len(ps) > 0 {
+		params = make(map[string]string, len(ps))
+		for _, p := range ps {
+			params[p.Key] = p.Value
+		}
+	}
+	return
+}
+
+// Param is a route param matched from path
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params are route params in the order of route pattern
+type Params []Param
+
+// Get returns value of the first param named key, or "" if not found
+func (ps Params) Get(key string) string {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// shorthands of param constraint, used as ":id<int>"
+var paramConstraints = map[string]string{
+	"int":   `[0-9]+`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"hex":   `[0-9a-fA-F]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"slug":  `[a-z0-9]+(?:-[a-z0-9]+)*`,
+}
+
+// parseParam parses the param starting with ':' at pos, like ":id" or ":id<\d+>".
+// param name consists of letters, digits and '_', so static text could follow param
+// in the same segment, like ":name.:ext".
+// end is the position right after the param.
+func parseParam(pattern string, pos int) (name, constraint string, re *regexp.Regexp, end int) {
+	end = pos + 1
+	for end < len(pattern) && isParamNameChar(pattern[end]) {
+		end++
+	}
+
+	name = pattern[pos+1 : end]
+	if name == "" {
+		panic("route: param name should not be empty, pattern: " + pattern)
+	}
+
+	if end < len(pattern) && pattern[end] == '<' {
+		constraint_end := constraintEnd(pattern, end)
+		if constraint_end < 0 {
+			panic("route: param constraint is not closed by >, pattern: " + pattern)
+		}
+
+		constraint = pattern[end+1 : constraint_end]
+		if constraint == "" {
+			panic("route: param constraint should not be empty, pattern: " + pattern)
+		}
+
+		re = compileConstraint(constraint)
+
+		end = constraint_end + 1
+	}
+
+	if end < len(pattern) && (pattern[end] == ':' || pattern[end] == '*' || pattern[end] == '<') {
+		panic("route: param should be followed by / or static text, pattern: " + pattern)
+	}
+
+	return
+}
+
+func isParamNameChar(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// constraintEnd returns position of '>' which closes the constraint starting with '<' at pos.
+// '>' escaped by '\' or in character class [...] does not close the constraint.
+func constraintEnd(pattern string, pos int) int {
+	in_class := false
+	for i := pos + 1; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			in_class = true
+		case ']':
+			in_class = false
+		case '>':
+			if !in_class {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func compileConstraint(constraint string) *regexp.Regexp {
+	expr := constraint
+	if v, ok := paramConstraints[constraint]; ok {
+		expr = v
+	}
+
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		panic("route: invalid param constraint <" + constraint + ">, " + err.Error())
+	}
+
+	return re
+}
+
+// checkCatchAll validates the catch-all param starting with '*' at pos, and returns its name
+func checkCatchAll(pattern string, pos int) string {
+	if pos == 0 || pattern[pos-1] != '/' {
+		panic("route: catch-all param should follow /, pattern: " + pattern)
+	}
+	name := pattern[pos+1:]
+	if strings.ContainsAny(name, "/:*") {
+		panic("route: catch-all param should be the last segment, pattern: " + pattern)
+	}
+	if name == "" {
+		panic("route: catch-all param name should not be empty")
+	}
+	return name
+}
+
+// checkStatic panics if static text of pattern contains '?'
+// we only match path in url, not query parameters
+func checkStatic(pattern, text string) {
+	if strings.Contains(text, "?") {
+		panic("route: pattern should not contain ?, pattern: " + pattern)
+	}
+}
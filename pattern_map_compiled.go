@@ -0,0 +1,248 @@
+package iafon
+
+import (
+	"regexp"
+	"strings"
+)
+
+// tCompiledTree is a read-only copy of PatternMapByTree created by PatternMapByTree.Compile.
+// nodes are in a flattened array, sub trees of a node are adjacent, static sub trees first,
+// so static sub trees are dispatched by the first byte of path instead of trying one by one.
+type tCompiledTree struct {
+	nodes []tCompiledNode
+
+	// the tree compiled, for Get
+	tree *PatternMapByTree
+}
+
+type tCompiledNode struct {
+	nType RouteTreeNodeType
+	text  string
+	value interface{}
+	re    *regexp.Regexp
+
+	// sub trees are nodes[trees : trees+ntrees], the first nstatic sub trees are static
+	trees   int32
+	ntrees  int32
+	nstatic int32
+
+	// indices[i] is the first byte of text of the ith static sub tree
+	indices string
+
+	// value to redirect to when path matches the node without the trailing slash, see RouteTree.redirectValue
+	redirect interface{}
+}
+
+// Compile returns a read-only copy of m, which matches path faster.
+// Set and Delete of the copy panic.
+func (m *PatternMapByTree) Compile() PatternMapInterface {
+	c := &tCompiledTree{tree: m}
+
+	if m.text == "" && len(m.trees) == 0 {
+		return c
+	}
+
+	// breadth first, so sub trees of a node are adjacent
+	queue := []*RouteTree{&m.RouteTree}
+	c.nodes = append(c.nodes, tCompiledNode{})
+
+	for i := 0; i < len(queue); i++ {
+		t := queue[i]
+		n := &c.nodes[i]
+
+		n.nType = t.nType
+		n.text = t.text
+		n.value = t.value
+		n.re = t.re
+		n.redirect = t.redirectValue()
+		n.trees = int32(len(c.nodes))
+		n.ntrees = int32(len(t.trees))
+
+		var indices []byte
+		for _, st := range t.trees {
+			if st.nType == cStatic {
+				indices = append(indices, st.text[0])
+			}
+		}
+		n.indices = string(indices)
+		n.nstatic = int32(len(indices))
+
+		queue = append(queue, t.trees...)
+		for range t.trees {
+			c.nodes = append(c.nodes, tCompiledNode{})
+		}
+	}
+
+	return c
+}
+
+func (c *tCompiledTree) Set(pattern string, value interface{}) {
+	panic("route: compiled matcher is read-only, fail to set pattern " + pattern)
+}
+
+func (c *tCompiledTree) Get(pattern string) interface{} {
+	return c.tree.Get(pattern)
+}
+
+func (c *tCompiledTree) Delete(pattern string) bool {
+	panic("route: compiled matcher is read-only, fail to delete pattern " + pattern)
+}
+
+// Clone returns c itself, because c is never modified
+func (c *tCompiledTree) Clone() PatternMapInterface {
+	return c
+}
+
+func (c *tCompiledTree) Len() int {
+	return c.tree.Len()
+}
+
+func (c *tCompiledTree) Match(path string) (value interface{}, params map[string]string, redirect bool, substr string) {
+	return matchMap(c, path)
+}
+
+// tCompiledFrame is a node being matched, like tMatchFrame
+type tCompiledFrame struct {
+	node int32
+
+	pos     int
+	end     int
+	nparams int
+
+	// index of the next sub tree to match, -1 means the static sub tree dispatched by the first byte
+	next int32
+
+	entered bool
+}
+
+// MatchParams matches path the same as RouteTree.MatchParams
+func (c *tCompiledTree) MatchParams(path string, ps *Params) (value interface{}, redirect bool, substr string) {
+	if len(c.nodes) == 0 {
+		return nil, false, ""
+	}
+
+	var frames_buf [32]tCompiledFrame
+	var fallback_buf [8]Param
+
+	frames := append(frames_buf[:0], tCompiledFrame{nparams: len(*ps), next: -1})
+	nparams := len(*ps)
+
+	var fallback_value interface{}
+	var fallback_redirect bool
+	var fallback_end int
+	fallback_params := fallback_buf[:0]
+
+	var setFallback = func(v interface{}, r bool, end int) {
+		if fallback_value != nil && (fallback_redirect || (!r && fallback_end >= end)) {
+			return
+		}
+		fallback_value, fallback_redirect, fallback_end = v, r, end
+		fallback_params = append(fallback_params[:0], (*ps)[nparams:]...)
+	}
+
+	for len(frames) > 0 {
+		f := &frames[len(frames)-1]
+		n := &c.nodes[f.node]
+
+		if !f.entered {
+			f.entered = true
+			*ps = (*ps)[:f.nparams]
+
+			switch n.nType {
+			case cStatic:
+				str := path[f.pos:]
+				if len(n.text) > len(str) || n.text != str[:len(n.text)] {
+					// "/path" redirects to "/path/"
+					if len(n.text) == len(str)+1 && n.text[len(str)] == '/' && n.text[:len(str)] == str {
+						if n.redirect != nil {
+							setFallback(n.redirect, true, len(path))
+						}
+					}
+					frames = frames[:len(frames)-1]
+					continue
+				}
+				f.end = f.pos + len(n.text)
+			case cParam:
+				seg_end := strings.IndexByte(path[f.pos:], '/')
+				if seg_end < 0 {
+					seg_end = len(path) - f.pos
+				}
+				if f.end = n.nextParamEnd(path, f.pos, f.pos+seg_end+1); f.end < 0 {
+					frames = frames[:len(frames)-1]
+					continue
+				}
+				*ps = append(*ps, Param{Key: n.text, Value: path[f.pos:f.end]})
+			case cCatchAll:
+				f.end = len(path)
+				*ps = append(*ps, Param{Key: n.text, Value: path[f.pos:]})
+			}
+
+			if n.value != nil {
+				if f.end == len(path) {
+					return n.value, false, path
+				} else if path[f.end] == '/' {
+					setFallback(n.value, false, f.end)
+				}
+			}
+		}
+
+		if f.next < 0 {
+			f.next = n.nstatic
+
+			// static sub trees start with different bytes, only one of them could match,
+			// if path ends, "/" is tried for redirect
+			b := byte('/')
+			if f.end < len(path) {
+				b = path[f.end]
+			}
+			if i := strings.IndexByte(n.indices, b); i >= 0 {
+				frames = append(frames, tCompiledFrame{node: n.trees + int32(i), pos: f.end, nparams: len(*ps), next: -1})
+				continue
+			}
+		}
+
+		if f.next < n.ntrees {
+			st := n.trees + f.next
+			f.next++
+
+			frames = append(frames, tCompiledFrame{node: st, pos: f.end, nparams: len(*ps), next: -1})
+			continue
+		}
+
+		if n.nType == cParam {
+			// backtrack, try a shorter param value
+			if end := n.nextParamEnd(path, f.pos, f.end); end > 0 {
+				f.end = end
+				f.next = -1
+				*ps = append((*ps)[:f.nparams], Param{Key: n.text, Value: path[f.pos:end]})
+				continue
+			}
+		}
+
+		*ps = (*ps)[:f.nparams]
+		frames = frames[:len(frames)-1]
+	}
+
+	*ps = append((*ps)[:nparams], fallback_params...)
+
+	if fallback_value == nil {
+		*ps = (*ps)[:nparams]
+		return nil, false, ""
+	}
+
+	return fallback_value, fallback_redirect, path[:fallback_end]
+}
+
+// nextParamEnd is the same as RouteTree.nextParamEnd
+func (n *tCompiledNode) nextParamEnd(path string, pos, before int) int {
+	for end := before - 1; end > pos; end-- {
+		if end < len(path) && path[end] != '/' && strings.IndexByte(n.indices, path[end]) < 0 {
+			continue
+		}
+		if n.re != nil && !n.re.MatchString(path[pos:end]) {
+			continue
+		}
+		return end
+	}
+	return -1
+}
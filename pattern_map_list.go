@@ -1,9 +1,13 @@
 package iafon
 
 import (
+	"regexp"
 	"strings"
 )
 
+// PatternMapByList matches path with patterns one by one, it is the reference of PatternMapByTree.
+// items are never modified after added, Clone copies the list only.
+// it is slower than PatternMapByTree when there are many patterns, but it uses less memory.
 type PatternMapByList []*tPatternListItem
 
 type tPatternListItem struct {
@@ -16,6 +20,10 @@ type tPatternListItem struct {
 type tSubPattern struct {
 	pType tSubPatternType
 	text  string
+
+	// constraint of param
+	constraint string
+	re         *regexp.Regexp
 }
 
 type tSubPatternType byte
@@ -23,24 +31,44 @@ type tSubPatternType byte
 const (
 	cSubPatternStatic tSubPatternType = iota
 	cSubPatternParam
+	cSubPatternCatchAll
+)
+
+type tListMatchMode byte
+
+const (
+	// pattern matches the whole path
+	cListMatchExact tListMatchMode = iota
+	// pattern matches prefix of path at segment boundary
+	cListMatchPrefix
+	// pattern matches the whole path with an extra trailing slash
+	cListMatchRedirect
 )
 
 func (m *PatternMapByList) Set(pattern string, value interface{}) {
-	item := newMapItem(pattern, value)
+	if pattern == "" {
+		panic("route: pattern should not be empty")
+	}
 
-	modified := false
+	if pattern[0] != '/' {
+		panic("route: pattern should start with /")
+	}
+
+	if value == nil {
+		panic("route: value should not be nil")
+	}
+
+	item := newMapItem(pattern, value)
 
 	for i, p := range *m {
 		if p.pattern == pattern {
 			(*m)[i] = item
-			modified = true
-			break
+			return
 		}
+		p.checkCatchAllConflict(item)
 	}
 
-	if !modified {
-		*m = append(*m, item)
-	}
+	*m = append(*m, item)
 }
 
 func (m *PatternMapByList) Get(pattern string) interface{} {
@@ -52,136 +80,287 @@ func (m *PatternMapByList) Get(pattern string) interface{} {
 	return nil
 }
 
+func (m *PatternMapByList) Delete(pattern string) bool {
+	for i, p := range *m {
+		if p.pattern == pattern {
+			*m = append((*m)[:i], (*m)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (m *PatternMapByList) Clone() PatternMapInterface {
+	c := append(PatternMapByList(nil), *m...)
+	return &c
+}
+
 func (m *PatternMapByList) Match(path string) (value interface{}, params map[string]string, redirect bool, substr string) {
-	var pre_p *tPatternListItem
-	var pre_substr string
-	var pre_params map[string]string
-	var pre_redirect bool = false
+	return matchMap(m, path)
+}
 
-	for _, p := range *m {
-		if matched, substr, params, redirect := p.match(path); matched {
-			if pre_p == nil ||
-				len(pre_substr) < len(substr) ||
-				(len(pre_substr) == len(substr) && pre_redirect && !redirect) ||
-				(len(pre_substr) == len(substr) && len(pre_params) > len(params)) {
-				pre_p = p
-				pre_substr = substr
-				pre_params = params
-				pre_redirect = redirect
-			}
-		}
+// MatchParams matches path with all patterns, matched params are appended to *ps.
+// the pattern matching the whole path wins, then redirect, then the longest prefix of path.
+// if several patterns match, see patternBefore.
+func (m *PatternMapByList) MatchParams(path string, ps *Params) (value interface{}, redirect bool, substr string) {
+	nparams := len(*ps)
+
+	if i, _, params := m.matchFirst(path, cListMatchExact, ps); i >= 0 {
+		*ps = append((*ps)[:nparams], params...)
+		return (*m)[i].value, false, path
 	}
 
-	if pre_p == nil {
-		return nil, nil, false, ""
-	} else {
-		return pre_p.value, pre_params, pre_redirect, pre_substr
+	// "/path" redirects to "/path/", and "/static" redirects to "/static/*filepath" too
+	if i, _, params := m.matchFirst(path+"/", cListMatchRedirect, ps); i >= 0 {
+		*ps = append((*ps)[:nparams], params...)
+		return (*m)[i].value, true, path
 	}
+
+	if i, end, params := m.matchFirst(path, cListMatchPrefix, ps); i >= 0 {
+		*ps = append((*ps)[:nparams], params...)
+		return (*m)[i].value, false, path[:end]
+	}
+
+	*ps = (*ps)[:nparams]
+	return nil, false, ""
+}
+
+// matchFirst returns index of the pattern matching path first, the end of matched path and params.
+// for prefix match, the longest prefix wins.
+func (m *PatternMapByList) matchFirst(path string, mode tListMatchMode, ps *Params) (best int, best_end int, best_params Params) {
+	nparams := len(*ps)
+	best = -1
+
+	for i, p := range *m {
+		*ps = (*ps)[:nparams]
+
+		end, matched := p.matchParts(0, path, 0, ps, mode)
+		if !matched {
+			continue
+		}
+
+		params := (*ps)[nparams:]
+
+		if best < 0 ||
+			end > best_end ||
+			(end == best_end && m.patternBefore(i, params, best, best_params)) {
+			best = i
+			best_end = end
+			best_params = append(best_params[:0], params...)
+		}
+	}
+
+	*ps = (*ps)[:nparams]
+
+	return
 }
 
 func (m *PatternMapByList) Len() int {
 	return len(*m)
 }
 
+// patternBefore reports whether the ith pattern wins over the jth pattern matching the same path.
+// patterns are compared from the start, the longer value of the same param wins because param is greedy.
+// where patterns differ, the pattern ending there wins, then static, constrained param, param and catch-all.
+// of different params with the same priority, the param added first wins.
+func (m *PatternMapByList) patternBefore(i int, i_params Params, j int, j_params Params) bool {
+	a, b := (*m)[i], (*m)[j]
+
+	ai, bi := 0, 0 // index of parts
+	ao, bo := 0, 0 // offset in static part
+	k := 0         // index of params
+
+	for {
+		for ai < len(a.parts) && a.parts[ai].pType == cSubPatternStatic && ao == len(a.parts[ai].text) {
+			ai, ao = ai+1, 0
+		}
+		for bi < len(b.parts) && b.parts[bi].pType == cSubPatternStatic && bo == len(b.parts[bi].text) {
+			bi, bo = bi+1, 0
+		}
+
+		if ai == len(a.parts) {
+			return bi < len(b.parts)
+		}
+		if bi == len(b.parts) {
+			return false
+		}
+
+		pa, pb := a.parts[ai], b.parts[bi]
+
+		if pa.pType == cSubPatternStatic && pb.pType == cSubPatternStatic {
+			if pa.text[ao] != pb.text[bo] {
+				// could not match the same path at the same position
+				return i < j
+			}
+			ao, bo = ao+1, bo+1
+			continue
+		}
+
+		if pa.pType == pb.pType && pa.text == pb.text && pa.constraint == pb.constraint {
+			// the same param node
+			if len(i_params[k].Value) != len(j_params[k].Value) {
+				return len(i_params[k].Value) > len(j_params[k].Value)
+			}
+			ai, bi, k = ai+1, bi+1, k+1
+			continue
+		}
+
+		if pa.priority() != pb.priority() {
+			return pa.priority() < pb.priority()
+		}
+
+		// the param added first is tried first
+		return m.firstWith(a, ai) < m.firstWith(b, bi)
+	}
+}
+
+// firstWith returns index of the first pattern with the same parts as p.parts[:n+1]
+func (m *PatternMapByList) firstWith(p *tPatternListItem, n int) int {
+	for i, item := range *m {
+		if len(item.parts) > n && item.samePrefix(p, n) {
+			return i
+		}
+	}
+	return -1
+}
+
 func newMapItem(pattern string, value interface{}) *tPatternListItem {
 	p := &tPatternListItem{pattern: pattern, value: value}
-	if strings.Contains(pattern, "?") {
-		panic("route pattern error. '" + pattern + "' should not contain '?'")
-	}
 	for pos := 0; pos >= 0; {
-		if pos_param := pos + strings.IndexByte(pattern[pos:], ':'); pos_param < pos {
+		if pos_param := pos + strings.IndexAny(pattern[pos:], ":*"); pos_param < pos {
+			checkStatic(pattern, pattern[pos:])
 			p.parts = append(p.parts, tSubPattern{pType: cSubPatternStatic, text: pattern[pos:]})
 			pos = -1
 		} else {
+			checkStatic(pattern, pattern[pos:pos_param])
 			p.parts = append(p.parts, tSubPattern{pType: cSubPatternStatic, text: pattern[pos:pos_param]})
-			if pos = pos_param + strings.IndexByte(pattern[pos_param:], '/'); pos >= pos_param {
-				p.parts = append(p.parts, tSubPattern{pType: cSubPatternParam, text: pattern[pos_param+1 : pos]})
-			} else {
-				p.parts = append(p.parts, tSubPattern{pType: cSubPatternParam, text: pattern[pos_param+1:]})
+			if pattern[pos_param] == '*' {
+				p.parts = append(p.parts, tSubPattern{pType: cSubPatternCatchAll, text: checkCatchAll(pattern, pos_param)})
 				pos = -1
+			} else {
+				name, constraint, re, end := parseParam(pattern, pos_param)
+				p.parts = append(p.parts, tSubPattern{pType: cSubPatternParam, text: name, constraint: constraint, re: re})
+				if pos = end; pos >= len(pattern) {
+					pos = -1
+				}
 			}
 		}
 	}
 	return p
 }
 
-func (p *tPatternListItem) match(path string) (matched bool, substr string, params map[string]string, redirect bool) {
-	matchedCount := 0
-	substr_end := 0
-	str := path
+// samePrefix reports whether p and item have the same parts[:n+1]
+func (p *tPatternListItem) samePrefix(item *tPatternListItem, n int) bool {
+	for k := 0; k <= n; k++ {
+		if !p.parts[k].equal(item.parts[k]) {
+			return false
+		}
+	}
+	return true
+}
 
-	end_i := len(p.parts) - 1
+// checkCatchAllConflict panics if p and item have different catch-all params after the same prefix
+func (p *tPatternListItem) checkCatchAllConflict(item *tPatternListItem) {
+	n := len(p.parts) - 1
+	if n != len(item.parts)-1 || p.parts[n].pType != cSubPatternCatchAll || item.parts[n].pType != cSubPatternCatchAll {
+		return
+	}
+	for i := 0; i < n; i++ {
+		if !p.parts[i].equal(item.parts[i]) {
+			return
+		}
+	}
+	if p.parts[n].text != item.parts[n].text {
+		panic("route: catch-all param '*" + item.parts[n].text + "' conflicts with '*" + p.parts[n].text + "'")
+	}
+}
 
-	for i, part := range p.parts {
-		if part.pType == cSubPatternParam {
-			if str == "" {
-				// mismatch
-				break
-			}
+func (part tSubPattern) equal(other tSubPattern) bool {
+	return part.pType == other.pType && part.text == other.text && part.constraint == other.constraint
+}
 
-			pos := strings.IndexByte(str, '/')
+// priority of part, the same as priority of RouteTree
+func (part tSubPattern) priority() int {
+	switch {
+	case part.pType == cSubPatternStatic:
+		return 0
+	case part.pType == cSubPatternParam && part.re != nil:
+		return 1
+	case part.pType == cSubPatternParam:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// matchParts matches parts from the ith part with path[pos:], matched params are appended to *ps.
+// end is the end of matched path.
+// param is greedy, the longest value is tried first, shorter values are only tried
+// if static text follows param in the same segment, like ":name.:ext".
+func (p *tPatternListItem) matchParts(i int, path string, pos int, ps *Params, mode tListMatchMode) (end int, matched bool) {
+	if i == len(p.parts) {
+		if mode != cListMatchPrefix {
+			return pos, pos == len(path)
+		}
+		// pattern should match path as a prefix at segment boundary
+		return pos, pos < len(path) && path[pos] == '/'
+	}
+
+	part := p.parts[i]
+	str := path[pos:]
+
+	switch part.pType {
+	case cSubPatternCatchAll:
+		// catch-all is always the last part, and it could be empty
+		if mode == cListMatchPrefix || (mode == cListMatchRedirect && str != "") {
+			return 0, false
+		}
+		// the same as PatternMapByTree, catch-all is not captured when redirecting
+		if mode != cListMatchRedirect {
+			*ps = append(*ps, Param{Key: part.text, Value: str})
+		}
+		return len(path), true
+
+	case cSubPatternParam:
+		seg_end := strings.IndexByte(str, '/')
+		if seg_end < 0 {
+			seg_end = len(str)
+		}
 
-			if pos == 0 {
-				// param value could not be empty
-				// mismatch
+		in_segment := i+1 < len(p.parts) &&
+			p.parts[i+1].pType == cSubPatternStatic &&
+			p.parts[i+1].text != "" &&
+			p.parts[i+1].text[0] != '/'
+
+		// param value could not be empty
+		for param_end := seg_end; param_end > 0; param_end-- {
+			if param_end < seg_end && !in_segment {
 				break
 			}
 
-			matchedCount++
+			param := str[:param_end]
 
-			if params == nil {
-				// make map only when param exists
-				params = make(map[string]string)
+			if part.re != nil && !part.re.MatchString(param) {
+				// constraint not satisfied
+				continue
 			}
 
-			if pos > 0 {
-				params[part.text] = str[:pos]
-				substr_end += pos
-				str = str[pos:]
-			} else {
-				params[part.text] = str
-				substr_end = len(path)
-				// may match redirect
-				str = ""
-			}
-		} else { // part.pType == cSubPatternStatic
-			// part should be str prefix
-			len_part := len(part.text)
-			len_str := len(str)
-			if len_part <= len_str && part.text == str[:len_part] {
-				if len_part == len_str {
-					substr_end += len_part
-					matchedCount++
-					// may match redirect
-					str = ""
-				} else if str[len_part-1] == '/' || str[len_part] == '/' {
-					substr_end += len_part
-					str = str[len_part:]
-					matchedCount++
-				} else {
-					// mismatch
-					break
-				}
-			} else if len_part > len_str {
-				if i == end_i && len_part == len_str+1 && part.text[len_part-1] == '/' && str == part.text[:len_part-1] {
-					matchedCount++
-					redirect = true
-					// match finished
-					break
-				} else {
-					// mismatch
-					break
-				}
-			} else {
-				// mismatch
-				break
+			n := len(*ps)
+			*ps = append(*ps, Param{Key: part.text, Value: param})
+
+			if end, matched = p.matchParts(i+1, path, pos+param_end, ps, mode); matched {
+				return
 			}
+
+			*ps = (*ps)[:n]
 		}
-	}
 
-	if matchedCount == len(p.parts) {
-		return true, path[:substr_end], params, redirect
-	} else {
-		return false, "", nil, false
+		return 0, false
+
+	default: // cSubPatternStatic
+		if strings.HasPrefix(str, part.text) {
+			return p.matchParts(i+1, path, pos+len(part.text), ps, mode)
+		}
+		return 0, false
 	}
 }
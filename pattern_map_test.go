@@ -0,0 +1,386 @@
+package iafon
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type tMatchCase struct {
+	path     string
+	value    string
+	params   map[string]string
+	redirect bool
+}
+
+// TestPatternMap is implemented by all matchers shipped
+type TestPatternMap interface {
+	PatternMapInterface
+	PatternMapParamsInterface
+	PatternMapCloneInterface
+}
+
+func newPatternMaps() map[string]TestPatternMap {
+	return map[string]TestPatternMap{
+		"tree": &PatternMapByTree{},
+		"list": &PatternMapByList{},
+	}
+}
+
+func testPatternMapMatch(t *testing.T, patterns []string, cases []tMatchCase) {
+	for name, m := range newPatternMaps() {
+		for _, p := range patterns {
+			m.Set(p, p)
+		}
+
+		for _, c := range cases {
+			var params Params
+			v, redirect, _ := m.MatchParams(c.path, &params)
+
+			value := ""
+			if v != nil {
+				value = v.(string)
+			}
+
+			if value != c.value || redirect != c.redirect {
+				t.Fatalf("%s: match '%s' error, expected %s %t, got %s %t", name, c.path, c.value, c.redirect, value, redirect)
+			}
+
+			if c.value == "" || c.redirect {
+				continue
+			}
+
+			if len(params) != len(c.params) {
+				t.Fatalf("%s: match '%s' params error, expected %v, got %v", name, c.path, c.params, params)
+			}
+			for k, v := range c.params {
+				if params.Get(k) != v {
+					t.Fatalf("%s: match '%s' params error, expected %v, got %v", name, c.path, c.params, params)
+				}
+			}
+		}
+	}
+}
+
+func TestMatchCatchAll(t *testing.T) {
+	patterns := []string{
+		"/static/*filepath",
+		"/static/favicon.ico",
+		"/static/:name/index.html",
+		"/proxy/*rest",
+	}
+
+	cases := []tMatchCase{
+		{"/static/css/app.css", "/static/*filepath", map[string]string{"filepath": "css/app.css"}, false},
+		{"/static/favicon.ico", "/static/favicon.ico", nil, false},
+		{"/static/favicon.ico/x", "/static/*filepath", map[string]string{"filepath": "favicon.ico/x"}, false},
+		{"/static/js/index.html", "/static/:name/index.html", map[string]string{"name": "js"}, false},
+		{"/static/js/main.js", "/static/*filepath", map[string]string{"filepath": "js/main.js"}, false},
+		{"/static/", "/static/*filepath", map[string]string{"filepath": ""}, false},
+		{"/static", "/static/*filepath", nil, true},
+		{"/proxy/a//b/", "/proxy/*rest", map[string]string{"rest": "a//b/"}, false},
+		{"/other/path", "", nil, false},
+	}
+
+	testPatternMapMatch(t, patterns, cases)
+
+	// exact match of catch-all beats redirect
+	patterns = append(patterns, "/*any")
+
+	cases = []tMatchCase{
+		{"/static/css/app.css", "/static/*filepath", map[string]string{"filepath": "css/app.css"}, false},
+		{"/static/", "/static/*filepath", map[string]string{"filepath": ""}, false},
+		{"/static", "/*any", map[string]string{"any": "static"}, false},
+		{"/other/path", "/*any", map[string]string{"any": "other/path"}, false},
+		{"/", "/*any", map[string]string{"any": ""}, false},
+	}
+
+	testPatternMapMatch(t, patterns, cases)
+}
+
+func TestCatchAllNotLastSegment(t *testing.T) {
+	invalid := []string{
+		"/static/*filepath/x",
+		"/static/*filepath/:name",
+		"/static/*",
+		"/static*filepath",
+	}
+
+	for name, m := range newPatternMaps() {
+		for _, p := range invalid {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Fatalf("%s: invalid catch-all pattern '%s' should panic", name, p)
+					}
+				}()
+				m.Set(p, p)
+			}()
+		}
+	}
+}
+
+func TestCatchAllConflict(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("catch-all params with different names should panic")
+		}
+	}()
+
+	m := &PatternMapByTree{}
+	m.Set("/static/*filepath", 1)
+	m.Set("/static/*path", 2)
+}
+
+func TestMatchParamConstraint(t *testing.T) {
+	patterns := []string{
+		`/user/:name<[a-z]+>`,
+		`/user/:id<\d+>`,
+		`/user/:any`,
+		`/item/:id<uuid>/:slug<slug>`,
+		`/item/:id<int>`,
+		`/range/:r<[0-9]{1,3}>`,
+	}
+
+	cases := []tMatchCase{
+		{"/user/42", `/user/:id<\d+>`, map[string]string{"id": "42"}, false},
+		{"/user/bob", `/user/:name<[a-z]+>`, map[string]string{"name": "bob"}, false},
+		{"/user/Bob", `/user/:any`, map[string]string{"any": "Bob"}, false},
+		{"/item/7", `/item/:id<int>`, map[string]string{"id": "7"}, false},
+		{"/item/x7", "", nil, false},
+		{"/item/123e4567-e89b-12d3-a456-426614174000/hello-world", `/item/:id<uuid>/:slug<slug>`,
+			map[string]string{"id": "123e4567-e89b-12d3-a456-426614174000", "slug": "hello-world"}, false},
+		{"/item/123e4567-e89b-12d3-a456-426614174000/Hello", "", nil, false},
+		{"/range/123", `/range/:r<[0-9]{1,3}>`, map[string]string{"r": "123"}, false},
+		{"/range/1234", "", nil, false},
+	}
+
+	testPatternMapMatch(t, patterns, cases)
+}
+
+func TestInvalidParamConstraint(t *testing.T) {
+	invalid := []string{
+		`/user/:id<\d+`,
+		`/user/:id<>`,
+		`/user/:id<[>`,
+		`/user/:id<(>`,
+		`/user/:id<int>:x`,
+		`/user/:id:x`,
+		`/user/:<int>`,
+	}
+
+	for name, m := range newPatternMaps() {
+		for _, p := range invalid {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Fatalf("%s: invalid param constraint pattern '%s' should panic", name, p)
+					}
+				}()
+				m.Set(p, p)
+			}()
+		}
+	}
+}
+
+func TestMatchMultiParamInSegment(t *testing.T) {
+	patterns := []string{
+		"/files/:name.:ext",
+		"/v:major.:minor/items",
+		"/v:major<int>/items",
+		"/date/:year<int>-:month<int>-:day<int>",
+		"/range/:from-:to",
+		"/pkg/:name@:version/*file",
+	}
+
+	cases := []tMatchCase{
+		{"/files/app.js", "/files/:name.:ext", map[string]string{"name": "app", "ext": "js"}, false},
+		// param is greedy, the last '.' separates name and ext
+		{"/files/archive.tar.gz", "/files/:name.:ext", map[string]string{"name": "archive.tar", "ext": "gz"}, false},
+		{"/files/README", "", nil, false},
+		{"/files/.gitignore", "", nil, false},
+		{"/v1.2/items", "/v:major.:minor/items", map[string]string{"major": "1", "minor": "2"}, false},
+		{"/v1/items", "/v:major<int>/items", map[string]string{"major": "1"}, false},
+		{"/date/2024-01-31", "/date/:year<int>-:month<int>-:day<int>", map[string]string{"year": "2024", "month": "01", "day": "31"}, false},
+		{"/date/2024-1a-31", "", nil, false},
+		// backtracking, "from" is shortened until "to" matches
+		{"/range/a-b-c", "/range/:from-:to", map[string]string{"from": "a-b", "to": "c"}, false},
+		{"/pkg/iafon@v1.0.0/src/a.go", "/pkg/:name@:version/*file", map[string]string{"name": "iafon", "version": "v1.0.0", "file": "src/a.go"}, false},
+	}
+
+	testPatternMapMatch(t, patterns, cases)
+}
+
+var differentialPatternSets = map[string][]string{
+	"priority": {
+		"/user",
+		"/user/admin",
+		"/user/:name",
+		"/user/:name/",
+		"/user/administrator",
+		"/a/b/",
+		"/",
+	},
+	"catch-all": {
+		"/static/*filepath",
+		"/static/favicon.ico",
+		"/static/:name/index.html",
+		"/static/",
+		"/proxy/*rest",
+		"/*any",
+	},
+	"constraint": {
+		`/user/:name<[a-z]+>`,
+		`/user/:id<\d+>`,
+		`/user/:any`,
+		`/user/:id<\d+>/posts`,
+		`/item/:id<uuid>/:slug<slug>`,
+		`/item/:id<int>`,
+		`/item/:name/`,
+	},
+	"segment": {
+		"/files/:name.:ext",
+		"/files/:name",
+		"/files/:name.json",
+		"/v:major.:minor/items",
+		"/v:major<int>/items",
+		"/range/:from-:to",
+		"/range/:from",
+		"/pkg/:name@:version/*file",
+	},
+	"siblings": {
+		"/u/:b/x",
+		"/u/:a",
+		"/u/:b",
+		"/u/:c<int>",
+		"/u/:d<alpha>/",
+		"/u/me",
+		"/u/:a/:b/:c",
+		"/u/*rest",
+	},
+}
+
+var differentialParamValues = []string{"42", "bob", "a-b", "123e4567-e89b-12d3-a456-426614174000", "x.y.z", "Bob7", "me"}
+
+var differentialCatchAllValues = []string{"", "a", "a/b/c", "a//b/"}
+
+// differentialPaths generates paths which may or may not match pattern
+func differentialPaths(pattern string) []string {
+	item := newMapItem(pattern, pattern)
+
+	var paths []string
+	for v := 0; v < len(differentialParamValues); v++ {
+		path := ""
+		for i, part := range item.parts {
+			switch part.pType {
+			case cSubPatternStatic:
+				path += part.text
+			case cSubPatternParam:
+				path += differentialParamValues[(v+i)%len(differentialParamValues)]
+			case cSubPatternCatchAll:
+				path += differentialCatchAllValues[v%len(differentialCatchAllValues)]
+			}
+		}
+
+		paths = append(paths, path, path+"/", path+"/x", path+"/x/y", path+"/x/")
+		if len(path) > 1 {
+			paths = append(paths, path[:len(path)-1], path[:len(path)/2])
+		}
+		if strings.HasSuffix(path, "/") && len(path) > 1 {
+			paths = append(paths, strings.TrimSuffix(path, "/"))
+		}
+	}
+
+	return paths
+}
+
+func testDifferentialMatch(t *testing.T, name string, patterns []string) {
+	tree := &PatternMapByTree{}
+	list := &PatternMapByList{}
+
+	for _, p := range patterns {
+		tree.Set(p, p)
+		list.Set(p, p)
+	}
+
+	compareMatchers(t, name, tree, list, patterns)
+	compareMatchers(t, name+" compiled", tree.Compile(), list, patterns)
+
+	// delete every other pattern, then add them back, which changes the order of tree nodes
+	cloned_tree, cloned_list := tree.Clone().(TestPatternMap), list.Clone().(TestPatternMap)
+
+	for i := 0; i < len(patterns); i += 2 {
+		if !cloned_tree.Delete(patterns[i]) || !cloned_list.Delete(patterns[i]) {
+			t.Fatalf("%s: fail to delete '%s'", name, patterns[i])
+		}
+	}
+	compareMatchers(t, name+" deleted", cloned_tree, cloned_list, patterns)
+	compareMatchers(t, name+" deleted compiled", cloned_tree.(*PatternMapByTree).Compile(), cloned_list, patterns)
+
+	for i := 0; i < len(patterns); i += 2 {
+		cloned_tree.Set(patterns[i], patterns[i])
+		cloned_list.Set(patterns[i], patterns[i])
+	}
+	compareMatchers(t, name+" added again", cloned_tree, cloned_list, patterns)
+
+	// the original is not affected by its clone
+	compareMatchers(t, name+" original", tree, list, patterns)
+	if tree.Len() != len(patterns) {
+		t.Fatalf("%s: original tree is modified by its clone", name)
+	}
+}
+
+func compareMatchers(t *testing.T, name string, tree, list PatternMapInterface, patterns []string) {
+	tree_m, list_m := tree.(PatternMapParamsInterface), list.(PatternMapParamsInterface)
+
+	if tree.Len() != list.Len() {
+		t.Fatalf("%s: Len differs, tree %d, list %d", name, tree.Len(), list.Len())
+	}
+
+	for _, p := range patterns {
+		if tree.Get(p) != list.Get(p) {
+			t.Fatalf("%s: Get('%s') differs, tree %v, list %v", name, p, tree.Get(p), list.Get(p))
+		}
+	}
+
+	for _, pattern := range patterns {
+		for _, path := range differentialPaths(pattern) {
+			var tree_params, list_params Params
+
+			tree_value, tree_redirect, tree_substr := tree_m.MatchParams(path, &tree_params)
+			list_value, list_redirect, list_substr := list_m.MatchParams(path, &list_params)
+
+			if tree_value != list_value || tree_redirect != list_redirect || tree_substr != list_substr ||
+				fmt.Sprint(tree_params) != fmt.Sprint(list_params) {
+				t.Fatalf("%s: match '%s' differs\ntree: %v %t %q %v\nlist: %v %t %q %v", name, path,
+					tree_value, tree_redirect, tree_substr, tree_params,
+					list_value, list_redirect, list_substr, list_params)
+			}
+		}
+	}
+}
+
+// all matchers shipped should return the same results
+func TestDifferentialMatch(t *testing.T) {
+	for name, patterns := range differentialPatternSets {
+		testDifferentialMatch(t, name, patterns)
+
+		// the order of adding affects priority of params, try the reversed order
+		reversed := make([]string, len(patterns))
+		for i, p := range patterns {
+			reversed[len(patterns)-1-i] = p
+		}
+		testDifferentialMatch(t, name+" reversed", reversed)
+	}
+
+	var github []string
+	added := make(map[string]bool)
+	for _, route := range githubAPI {
+		pattern := strings.SplitN(route, " ", 2)[1]
+		if !added[pattern] {
+			github = append(github, pattern)
+			added[pattern] = true
+		}
+	}
+	testDifferentialMatch(t, "github", github)
+}
@@ -2,13 +2,17 @@ package iafon
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
+// PatternMapByTree matches path with patterns by a radix tree.
+// tree nodes are copied before modified, so Clone is cheap and the clone could be modified
+// while the original is matching paths in other goroutines.
 type PatternMapByTree struct {
 	RouteTree
-	values map[string]interface{}
+	count int
 }
 
 type RouteTree struct {
@@ -20,6 +24,10 @@ type RouteTreeNode struct {
 	nType RouteTreeNodeType
 	text  string
 	value interface{}
+
+	// constraint of param, like "int" in ":id<int>" or `\d+` in `:id<\d+>`
+	constraint string
+	re         *regexp.Regexp
 }
 
 type RouteTreeNodeType byte
@@ -27,22 +35,37 @@ type RouteTreeNodeType byte
 const (
 	cStatic RouteTreeNodeType = iota
 	cParam
+	// catch-all param, match the rest of path, slashes included
+	cCatchAll
 )
 
 func (m *PatternMapByTree) Set(pattern string, value interface{}) {
+	exists := m.Get(pattern) != nil
 	m.RouteTree.Set(pattern, value)
-	if m.values == nil {
-		m.values = make(map[string]interface{})
+	if !exists {
+		m.count++
 	}
-	m.values[pattern] = value
 }
 
 func (m *PatternMapByTree) Get(pattern string) interface{} {
-	return m.values[pattern]
+	return m.RouteTree.Get(pattern)
+}
+
+func (m *PatternMapByTree) Delete(pattern string) bool {
+	if !m.RouteTree.Delete(pattern) {
+		return false
+	}
+	m.count--
+	return true
+}
+
+func (m *PatternMapByTree) Clone() PatternMapInterface {
+	c := *m
+	return &c
 }
 
 func (m *PatternMapByTree) Len() int {
-	return len(m.values)
+	return m.count
 }
 
 func (t *RouteTree) Set(pattern string, value interface{}) {
@@ -54,109 +77,351 @@ func (t *RouteTree) Set(pattern string, value interface{}) {
 		panic("route: pattern should start with /")
 	}
 
-	// we only match path in url, not parameters
-	if strings.Contains(pattern, "?") {
-		panic("route: pattern should not contain ?")
-	}
-
 	if value == nil {
 		panic("route: value should not be nil")
 	}
 
+	// nodes shared with other trees are copied before modified, see PatternMapByTree.Clone
+	t.trees = append([]*RouteTree(nil), t.trees...)
+
 	if !t.mergePath(newRoutePath(pattern, value)) {
-		panic("route path pattern should start with /")
+		panic("route: fail to merge pattern " + pattern)
 	}
 }
 
-// TODO: do not recursive call
-func (t *RouteTree) Match(path string) (value interface{}, params map[string]string, redirect bool, substr string) {
-	if t.nType == cStatic {
-		len_n := len(t.text)
-		len_p := len(path)
-
-		if len_n-len_p < 1 {
-			if t.text == path[:len_n] {
-				value, params, redirect, substr = t.matchSubTrees(path[len_n:])
-				if value != nil {
-					if substr != "" {
-						substr = t.text + substr
-					} else if t.value != nil {
-						value = t.value
-						redirect = false
-						substr = t.text
-					}
-				} else if len_n == len_p || path[len_n] == '/' {
-					value = t.value
-					substr = t.text
-				}
-			}
-		} else if len_n-len_p == 1 {
-			if t.text[len_n-1] == '/' && t.text[:len_n-1] == path {
-				value = t.value
-				redirect = true
-				substr = path
-			}
+// Get returns value of pattern, nil if pattern is not set
+func (t *RouteTree) Get(pattern string) interface{} {
+	if pattern == "" || pattern[0] != '/' {
+		return nil
+	}
+	if n := t.findPath(newRoutePath(pattern, nil)); n != nil {
+		return n.value
+	}
+	return nil
+}
+
+// Delete removes pattern from tree, reports whether pattern is found.
+// like Set, nodes are copied before modified.
+func (t *RouteTree) Delete(pattern string) bool {
+	if pattern == "" || pattern[0] != '/' {
+		return false
+	}
+
+	n, deleted := t.deletePath(newRoutePath(pattern, nil))
+	if !deleted {
+		return false
+	}
+
+	if n == nil {
+		*t = RouteTree{}
+	} else {
+		*t = *n
+	}
+	return true
+}
+
+// nextPath reports whether t is the same node as the first node of path p,
+// next is the rest of p, nil if t is the last node of p
+func (t *RouteTree) nextPath(p *RouteTree) (next *RouteTree, same bool) {
+	switch {
+	case t.nType == cStatic && p.nType == cStatic:
+		// static text of p could be split to several nodes
+		if !strings.HasPrefix(p.text, t.text) {
+			return nil, false
 		}
-	} else if t.nType == cParam {
-		if path != "" {
-			if param_end := strings.IndexByte(path, '/'); param_end != 0 {
-				param := ""
-				sub_path := ""
-
-				if param_end > 0 {
-					param = path[:param_end]
-					sub_path = path[param_end:]
+		if len(p.text) > len(t.text) {
+			rest := *p
+			rest.text = p.text[len(t.text):]
+			return &rest, true
+		}
+	case t.nType == p.nType && t.text == p.text && t.constraint == p.constraint:
+	default:
+		return nil, false
+	}
+
+	if len(p.trees) > 0 {
+		return p.trees[0], true
+	}
+	return nil, true
+}
+
+// findPath returns the node of the last node of path p
+func (t *RouteTree) findPath(p *RouteTree) *RouteTree {
+	next, same := t.nextPath(p)
+	if !same {
+		return nil
+	}
+	if next == nil {
+		return t
+	}
+	for _, st := range t.trees {
+		if n := st.findPath(next); n != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+// deletePath returns a copy of t without the value of path p, the copy is nil if it is empty
+func (t *RouteTree) deletePath(p *RouteTree) (n *RouteTree, deleted bool) {
+	next, same := t.nextPath(p)
+	if !same {
+		return t, false
+	}
+
+	n = t.copy()
+
+	if next == nil {
+		if t.value == nil {
+			return t, false
+		}
+		n.value = nil
+	} else {
+		for i, st := range t.trees {
+			if c, ok := st.deletePath(next); ok {
+				if c == nil {
+					n.trees = append(n.trees[:i], n.trees[i+1:]...)
 				} else {
-					param = path
-					sub_path = ""
+					n.trees[i] = c
 				}
+				deleted = true
+				break
+			}
+		}
+		if !deleted {
+			return t, false
+		}
+	}
+
+	return n.compact(), true
+}
+
+// compact returns nil if t is empty, or merges static t with its only static sub tree
+func (t *RouteTree) compact() *RouteTree {
+	if t.value == nil && len(t.trees) == 0 {
+		return nil
+	}
+	if t.nType == cStatic && t.value == nil && len(t.trees) == 1 && t.trees[0].nType == cStatic {
+		st := t.trees[0]
+		t.text += st.text
+		t.value = st.value
+		t.trees = st.trees
+	}
+	return t
+}
+
+// copy returns a copy of t which could be modified without affecting t
+func (t *RouteTree) copy() *RouteTree {
+	c := *t
+	c.trees = append([]*RouteTree(nil), t.trees...)
+	return &c
+}
+
+// canMerge reports whether p could be merged into t, see mergePath
+func (t *RouteTree) canMerge(p *RouteTree) bool {
+	switch {
+	case t.nType == cStatic && p.nType == cStatic:
+		return t.text[0] == p.text[0]
+	case t.nType == cParam && p.nType == cParam:
+		return t.text == p.text && t.constraint == p.constraint
+	default:
+		return t.nType == cCatchAll && p.nType == cCatchAll
+	}
+}
+
+func (t *RouteTree) Match(path string) (value interface{}, params map[string]string, redirect bool, substr string) {
+	return matchMap(t, path)
+}
+
+// tMatchFrame is a tree node being matched
+type tMatchFrame struct {
+	t *RouteTree
+
+	// position of path where t starts to match
+	pos int
+	// position of path where t ends, sub trees start to match from here
+	end int
+	// index of the next sub tree to match
+	next int
+	// count of params before t is matched
+	nparams int
+
+	entered bool
+}
 
-				value, params, redirect, substr = t.matchSubTrees(sub_path)
-				if value != nil {
-					if redirect && substr == "" && t.value != nil {
-						value = t.value
-						redirect = false
+// MatchParams matches path without recursion, matched params are appended to *ps.
+// *ps could be reused between matches to avoid allocation.
+//
+// sub trees are tried in order of priority: static, constrained param, param, catch-all.
+// param is greedy, the longest value is tried first.
+// the first tree matching the whole path wins.
+// if no tree matches the whole path, redirect wins, then the longest prefix of path at segment boundary.
+func (t *RouteTree) MatchParams(path string, ps *Params) (value interface{}, redirect bool, substr string) {
+	// frames and fallback params are on stack, unless the tree is very deep
+	var frames_buf [32]tMatchFrame
+	var fallback_buf [8]Param
+
+	frames := append(frames_buf[:0], tMatchFrame{t: t, nparams: len(*ps)})
+	nparams := len(*ps)
+
+	// fallback is the best redirect or prefix match
+	var fallback_value interface{}
+	var fallback_redirect bool
+	var fallback_end int
+	fallback_params := fallback_buf[:0]
+
+	var setFallback = func(v interface{}, r bool, end int) {
+		if fallback_value != nil && (fallback_redirect || (!r && fallback_end >= end)) {
+			return
+		}
+		fallback_value, fallback_redirect, fallback_end = v, r, end
+		fallback_params = append(fallback_params[:0], (*ps)[nparams:]...)
+	}
+
+	for len(frames) > 0 {
+		f := &frames[len(frames)-1]
+		n := f.t
+
+		if !f.entered {
+			f.entered = true
+			*ps = (*ps)[:f.nparams]
+
+			switch n.nType {
+			case cStatic:
+				str := path[f.pos:]
+				if len(n.text) > len(str) || n.text != str[:len(n.text)] {
+					// "/path" redirects to "/path/"
+					if len(n.text) == len(str)+1 && n.text[len(str)] == '/' && n.text[:len(str)] == str {
+						if v := n.redirectValue(); v != nil {
+							setFallback(v, true, len(path))
+						}
 					}
-					substr = param + substr
-				} else {
-					value = t.value
-					substr = param
+					frames = frames[:len(frames)-1]
+					continue
 				}
-				if params == nil {
-					params = make(map[string]string)
+				f.end = f.pos + len(n.text)
+			case cParam:
+				seg_end := strings.IndexByte(path[f.pos:], '/')
+				if seg_end < 0 {
+					seg_end = len(path) - f.pos
+				}
+				if f.end = n.nextParamEnd(path, f.pos, f.pos+seg_end+1); f.end < 0 {
+					frames = frames[:len(frames)-1]
+					continue
+				}
+				*ps = append(*ps, Param{Key: n.text, Value: path[f.pos:f.end]})
+			case cCatchAll:
+				f.end = len(path)
+				*ps = append(*ps, Param{Key: n.text, Value: path[f.pos:]})
+			}
+
+			if n.value != nil {
+				if f.end == len(path) {
+					// the whole path is matched
+					return n.value, false, path
+				} else if path[f.end] == '/' {
+					// prefix of path at segment boundary
+					setFallback(n.value, false, f.end)
 				}
-				params[t.text] = param
 			}
 		}
+
+		if f.next < len(n.trees) {
+			st := n.trees[f.next]
+			f.next++
+
+			frames = append(frames, tMatchFrame{t: st, pos: f.end, nparams: len(*ps)})
+			continue
+		}
+
+		if n.nType == cParam {
+			// backtrack, try a shorter param value
+			if end := n.nextParamEnd(path, f.pos, f.end); end > 0 {
+				f.end = end
+				f.next = 0
+				*ps = append((*ps)[:f.nparams], Param{Key: n.text, Value: path[f.pos:end]})
+				continue
+			}
+		}
+
+		*ps = (*ps)[:f.nparams]
+		frames = frames[:len(frames)-1]
 	}
 
-	return
+	*ps = append((*ps)[:nparams], fallback_params...)
+
+	if fallback_value == nil {
+		*ps = (*ps)[:nparams]
+		return nil, false, ""
+	}
+
+	return fallback_value, fallback_redirect, path[:fallback_end]
 }
 
-func (t *RouteTree) matchSubTrees(path string) (value interface{}, params map[string]string, redirect bool, substr string) {
-	len_substr, len_curr_substr := 0, 0
-	static_matched := false
-	for _, st := range t.trees {
-		if st.nType == cStatic && static_matched {
+// nextParamEnd returns the end of the next param value shorter than path[pos:before], or -1.
+// the value ending at the end of segment is tried first,
+// shorter values are only tried if static text follows param in the same segment, like ":name.:ext".
+func (t *RouteTree) nextParamEnd(path string, pos, before int) int {
+	for end := before - 1; end > pos; end-- {
+		if end < len(path) && path[end] != '/' && !t.hasSegmentTree(path[end]) {
 			continue
 		}
-		if curr_value, curr_params, curr_redirect, curr_substr := st.Match(path); curr_value != nil {
-			if st.nType == cStatic {
-				static_matched = true
-			}
-			len_substr, len_curr_substr = len(substr), len(curr_substr)
-			if value == nil ||
-				len_substr < len_curr_substr ||
-				(len_substr == len_curr_substr && redirect && !curr_redirect) ||
-				(len_substr == len_curr_substr && len(params) > len(curr_params)) {
-				value = curr_value
-				params = curr_params
-				redirect = curr_redirect
-				substr = curr_substr
-			}
+		if t.re != nil && !t.re.MatchString(path[pos:end]) {
+			// constraint not satisfied
+			continue
 		}
+		return end
 	}
-	return
+	return -1
+}
+
+// hasSegmentTree reports whether static text starting with b follows the param node in the same segment
+func (t *RouteTree) hasSegmentTree(b byte) bool {
+	for _, st := range t.trees {
+		if st.nType == cStatic && st.text[0] == b {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectValue is the value to redirect to when path matches t without the trailing slash
+func (t *RouteTree) redirectValue() interface{} {
+	if t.value != nil {
+		return t.value
+	}
+	// "/static" redirects to "/static/" if "/static/*filepath" is registered
+	for _, st := range t.trees {
+		if st.nType == cCatchAll {
+			return st.value
+		}
+	}
+	return nil
+}
+
+// priority of sub tree, sub trees are sorted by priority
+func (t *RouteTree) priority() int {
+	switch {
+	case t.nType == cStatic:
+		return 0
+	case t.nType == cParam && t.re != nil:
+		return 1
+	case t.nType == cParam:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// addSubTree adds st after sub trees with the same or higher priority
+func (t *RouteTree) addSubTree(st *RouteTree) {
+	i := len(t.trees)
+	for i > 0 && t.trees[i-1].priority() > st.priority() {
+		i--
+	}
+	t.trees = append(t.trees, nil)
+	copy(t.trees[i+1:], t.trees[i:])
+	t.trees[i] = st
 }
 
 func (t *RouteTree) mergePath(p *RouteTree) bool {
@@ -173,14 +438,17 @@ func (t *RouteTree) mergePath(p *RouteTree) bool {
 				t.trees = p.trees
 			} else {
 				merged := false
-				for _, st := range t.trees {
-					if m := st.mergePath(p.trees[0]); m {
-						merged = m
+				for i, st := range t.trees {
+					// t is a copy, but its sub trees may be shared with other trees
+					if st.canMerge(p.trees[0]) {
+						c := st.copy()
+						merged = c.mergePath(p.trees[0])
+						t.trees[i] = c
 						break
 					}
 				}
 				if !merged {
-					t.trees = append(t.trees, p.trees[0])
+					t.addSubTree(p.trees[0])
 				}
 			}
 		} else {
@@ -216,15 +484,22 @@ func (t *RouteTree) mergePath(p *RouteTree) bool {
 		mergeSameNode(t, p)
 		return true
 	} else if t.nType == cParam && p.nType == cParam {
-		if t.text == p.text {
+		if t.text == p.text && t.constraint == p.constraint {
 			mergeSameNode(t, p)
 			return true
 		} else {
-			// param name not equal, merge failed
+			// param name or constraint not equal, merge failed
+			// p will be added as a sibling of t
 			return false
 		}
+	} else if t.nType == cCatchAll && p.nType == cCatchAll {
+		if t.text != p.text {
+			panic("route: catch-all param '*" + p.text + "' conflicts with '*" + t.text + "'")
+		}
+		mergeSameNode(t, p)
+		return true
 	} else {
-		// cStatic tree node can not merge with cParam tree node, merge failed
+		// different node types can not merge, merge failed
 		return false
 	}
 }
@@ -237,16 +512,27 @@ func (t *RouteTree) split(prefix string) {
 	t.trees = []*RouteTree{suffixNode}
 }
 
+// label returns text of node as in pattern, like ":id<int>"
+func (t *RouteTree) label() string {
+	text := t.text
+	if t.nType == cParam {
+		text = ":" + text
+		if t.constraint != "" {
+			text += "<" + t.constraint + ">"
+		}
+	} else if t.nType == cCatchAll {
+		text = hideMountParam("*" + text)
+	}
+	return text
+}
+
 func (t *RouteTree) Print(_indent ...int) {
 	indent := 0
 	if len(_indent) > 0 {
 		indent = _indent[0]
 	}
 
-	text := t.text
-	if t.nType == cParam {
-		text = ":" + text
-	}
+	text := t.label()
 
 	fmt.Printf("%"+strconv.Itoa(indent)+"s%s : %t\n", "", text, t.value != nil)
 
@@ -266,28 +552,33 @@ func newRoutePath(pattern string, value interface{}) *RouteTree {
 	pos := 0
 
 	for {
-		if pos_param := pos + strings.IndexByte(pattern[pos:], ':'); pos_param < pos {
+		if pos_param := pos + strings.IndexAny(pattern[pos:], ":*"); pos_param < pos {
 			curr.nType = cStatic
 			curr.text = pattern[pos:]
+			checkStatic(pattern, curr.text)
 			break
 		} else {
 			curr.nType = cStatic
 			curr.text = pattern[pos:pos_param]
+			checkStatic(pattern, curr.text)
 			curr.trees = []*RouteTree{&RouteTree{}}
 
 			curr = curr.trees[0]
+
+			if pattern[pos_param] == '*' {
+				curr.nType = cCatchAll
+				curr.text = checkCatchAll(pattern, pos_param)
+				break
+			}
+
 			curr.nType = cParam
+			curr.text, curr.constraint, curr.re, pos = parseParam(pattern, pos_param)
 
-			if pos = pos_param + strings.IndexByte(pattern[pos_param:], '/'); pos >= pos_param {
-				if pos_param+1 >= pos {
-					panic("route: param name should not be empty")
-				}
-				curr.text = pattern[pos_param+1 : pos]
+			if pos < len(pattern) {
 				curr.trees = []*RouteTree{&RouteTree{}}
 
 				curr = curr.trees[0]
 			} else {
-				curr.text = pattern[pos_param+1:]
 				break
 			}
 		}
@@ -0,0 +1,507 @@
+package iafon
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// routes of GitHub API v3, widely used by http router benchmarks
+var githubAPI = []string{
+	// OAuth Authorizations
+	"GET /authorizations",
+	"GET /authorizations/:id",
+	"POST /authorizations",
+	"DELETE /authorizations/:id",
+	"GET /applications/:client_id/tokens/:access_token",
+	"DELETE /applications/:client_id/tokens",
+	"DELETE /applications/:client_id/tokens/:access_token",
+
+	// Activity
+	"GET /events",
+	"GET /repos/:owner/:repo/events",
+	"GET /networks/:owner/:repo/events",
+	"GET /orgs/:org/events",
+	"GET /users/:user/received_events",
+	"GET /users/:user/received_events/public",
+	"GET /users/:user/events",
+	"GET /users/:user/events/public",
+	"GET /users/:user/events/orgs/:org",
+	"GET /feeds",
+	"GET /notifications",
+	"GET /repos/:owner/:repo/notifications",
+	"PUT /notifications",
+	"PUT /repos/:owner/:repo/notifications",
+	"GET /notifications/threads/:id",
+	"GET /notifications/threads/:id/subscription",
+	"PUT /notifications/threads/:id/subscription",
+	"DELETE /notifications/threads/:id/subscription",
+	"GET /repos/:owner/:repo/stargazers",
+	"GET /users/:user/starred",
+	"GET /user/starred",
+	"GET /user/starred/:owner/:repo",
+	"PUT /user/starred/:owner/:repo",
+	"DELETE /user/starred/:owner/:repo",
+	"GET /repos/:owner/:repo/subscribers",
+	"GET /users/:user/subscriptions",
+	"GET /user/subscriptions",
+	"GET /repos/:owner/:repo/subscription",
+	"PUT /repos/:owner/:repo/subscription",
+	"DELETE /repos/:owner/:repo/subscription",
+	"GET /user/subscriptions/:owner/:repo",
+	"PUT /user/subscriptions/:owner/:repo",
+	"DELETE /user/subscriptions/:owner/:repo",
+
+	// Gists
+	"GET /users/:user/gists",
+	"GET /gists",
+	"GET /gists/:id",
+	"POST /gists",
+	"PUT /gists/:id/star",
+	"DELETE /gists/:id/star",
+	"GET /gists/:id/star",
+	"POST /gists/:id/forks",
+	"DELETE /gists/:id",
+
+	// Git Data
+	"GET /repos/:owner/:repo/git/blobs/:sha",
+	"POST /repos/:owner/:repo/git/blobs",
+	"GET /repos/:owner/:repo/git/commits/:sha",
+	"POST /repos/:owner/:repo/git/commits",
+	"GET /repos/:owner/:repo/git/refs",
+	"POST /repos/:owner/:repo/git/refs",
+	"GET /repos/:owner/:repo/git/tags/:sha",
+	"POST /repos/:owner/:repo/git/tags",
+	"GET /repos/:owner/:repo/git/trees/:sha",
+	"POST /repos/:owner/:repo/git/trees",
+
+	// Issues
+	"GET /issues",
+	"GET /user/issues",
+	"GET /orgs/:org/issues",
+	"GET /repos/:owner/:repo/issues",
+	"GET /repos/:owner/:repo/issues/:number",
+	"POST /repos/:owner/:repo/issues",
+	"GET /repos/:owner/:repo/assignees",
+	"GET /repos/:owner/:repo/assignees/:assignee",
+	"GET /repos/:owner/:repo/issues/:number/comments",
+	"POST /repos/:owner/:repo/issues/:number/comments",
+	"GET /repos/:owner/:repo/issues/:number/events",
+	"GET /repos/:owner/:repo/labels",
+	"GET /repos/:owner/:repo/labels/:name",
+	"POST /repos/:owner/:repo/labels",
+	"DELETE /repos/:owner/:repo/labels/:name",
+	"GET /repos/:owner/:repo/issues/:number/labels",
+	"POST /repos/:owner/:repo/issues/:number/labels",
+	"DELETE /repos/:owner/:repo/issues/:number/labels/:name",
+	"PUT /repos/:owner/:repo/issues/:number/labels",
+	"DELETE /repos/:owner/:repo/issues/:number/labels",
+	"GET /repos/:owner/:repo/milestones/:number/labels",
+	"GET /repos/:owner/:repo/milestones",
+	"GET /repos/:owner/:repo/milestones/:number",
+	"POST /repos/:owner/:repo/milestones",
+	"DELETE /repos/:owner/:repo/milestones/:number",
+
+	// Miscellaneous
+	"GET /emojis",
+	"GET /gitignore/templates",
+	"GET /gitignore/templates/:name",
+	"POST /markdown",
+	"POST /markdown/raw",
+	"GET /meta",
+	"GET /rate_limit",
+
+	// Organizations
+	"GET /users/:user/orgs",
+	"GET /user/orgs",
+	"GET /orgs/:org",
+	"GET /orgs/:org/members",
+	"GET /orgs/:org/members/:user",
+	"DELETE /orgs/:org/members/:user",
+	"GET /orgs/:org/public_members",
+	"GET /orgs/:org/public_members/:user",
+	"PUT /orgs/:org/public_members/:user",
+	"DELETE /orgs/:org/public_members/:user",
+	"GET /orgs/:org/teams",
+	"GET /teams/:id",
+	"POST /orgs/:org/teams",
+	"DELETE /teams/:id",
+	"GET /teams/:id/members",
+	"GET /teams/:id/members/:user",
+	"PUT /teams/:id/members/:user",
+	"DELETE /teams/:id/members/:user",
+	"GET /teams/:id/repos",
+	"GET /teams/:id/repos/:owner/:repo",
+	"PUT /teams/:id/repos/:owner/:repo",
+	"DELETE /teams/:id/repos/:owner/:repo",
+	"GET /user/teams",
+
+	// Pull Requests
+	"GET /repos/:owner/:repo/pulls",
+	"GET /repos/:owner/:repo/pulls/:number",
+	"POST /repos/:owner/:repo/pulls",
+	"GET /repos/:owner/:repo/pulls/:number/commits",
+	"GET /repos/:owner/:repo/pulls/:number/files",
+	"GET /repos/:owner/:repo/pulls/:number/merge",
+	"PUT /repos/:owner/:repo/pulls/:number/merge",
+	"GET /repos/:owner/:repo/pulls/:number/comments",
+	"PUT /repos/:owner/:repo/pulls/:number/comments",
+
+	// Repositories
+	"GET /user/repos",
+	"GET /users/:user/repos",
+	"GET /orgs/:org/repos",
+	"GET /repositories",
+	"POST /user/repos",
+	"POST /orgs/:org/repos",
+	"GET /repos/:owner/:repo",
+	"GET /repos/:owner/:repo/contributors",
+	"GET /repos/:owner/:repo/languages",
+	"GET /repos/:owner/:repo/teams",
+	"GET /repos/:owner/:repo/tags",
+	"GET /repos/:owner/:repo/branches",
+	"GET /repos/:owner/:repo/branches/:branch",
+	"DELETE /repos/:owner/:repo",
+	"GET /repos/:owner/:repo/collaborators",
+	"GET /repos/:owner/:repo/collaborators/:user",
+	"PUT /repos/:owner/:repo/collaborators/:user",
+	"DELETE /repos/:owner/:repo/collaborators/:user",
+	"GET /repos/:owner/:repo/comments",
+	"GET /repos/:owner/:repo/commits/:sha/comments",
+	"POST /repos/:owner/:repo/commits/:sha/comments",
+	"GET /repos/:owner/:repo/comments/:id",
+	"DELETE /repos/:owner/:repo/comments/:id",
+	"GET /repos/:owner/:repo/commits",
+	"GET /repos/:owner/:repo/commits/:sha",
+	"GET /repos/:owner/:repo/readme",
+	"GET /repos/:owner/:repo/keys",
+	"GET /repos/:owner/:repo/keys/:id",
+	"POST /repos/:owner/:repo/keys",
+	"DELETE /repos/:owner/:repo/keys/:id",
+	"GET /repos/:owner/:repo/downloads",
+	"GET /repos/:owner/:repo/downloads/:id",
+	"DELETE /repos/:owner/:repo/downloads/:id",
+	"GET /repos/:owner/:repo/forks",
+	"POST /repos/:owner/:repo/forks",
+	"GET /repos/:owner/:repo/hooks",
+	"GET /repos/:owner/:repo/hooks/:id",
+	"POST /repos/:owner/:repo/hooks",
+	"POST /repos/:owner/:repo/hooks/:id/tests",
+	"DELETE /repos/:owner/:repo/hooks/:id",
+	"POST /repos/:owner/:repo/merges",
+	"GET /repos/:owner/:repo/releases",
+	"GET /repos/:owner/:repo/releases/:id",
+	"POST /repos/:owner/:repo/releases",
+	"DELETE /repos/:owner/:repo/releases/:id",
+	"GET /repos/:owner/:repo/releases/:id/assets",
+	"GET /repos/:owner/:repo/stats/contributors",
+	"GET /repos/:owner/:repo/stats/commit_activity",
+	"GET /repos/:owner/:repo/stats/code_frequency",
+	"GET /repos/:owner/:repo/stats/participation",
+	"GET /repos/:owner/:repo/stats/punch_card",
+	"GET /repos/:owner/:repo/statuses/:ref",
+	"POST /repos/:owner/:repo/statuses/:ref",
+
+	// Search
+	"GET /search/repositories",
+	"GET /search/code",
+	"GET /search/issues",
+	"GET /search/users",
+	"GET /legacy/issues/search/:owner/:repository/:state/:keyword",
+	"GET /legacy/repos/search/:keyword",
+	"GET /legacy/user/search/:keyword",
+	"GET /legacy/user/email/:email",
+
+	// Users
+	"GET /users/:user",
+	"GET /user",
+	"GET /users",
+	"GET /user/emails",
+	"POST /user/emails",
+	"DELETE /user/emails",
+	"GET /users/:user/followers",
+	"GET /user/followers",
+	"GET /users/:user/following",
+	"GET /user/following",
+	"GET /user/following/:user",
+	"GET /users/:user/following/:target_user",
+	"PUT /user/following/:user",
+	"DELETE /user/following/:user",
+	"GET /users/:user/keys",
+	"GET /user/keys",
+	"GET /user/keys/:id",
+	"POST /user/keys",
+	"DELETE /user/keys/:id",
+}
+
+// githubPath replaces params in pattern with param names, "/users/:user" to "/users/user"
+func githubPath(pattern string) string {
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			parts[i] = part[1:]
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func newGithubTree() (*PatternMapByTree, []string) {
+	m := &PatternMapByTree{}
+	var paths []string
+	for _, route := range githubAPI {
+		pattern := strings.SplitN(route, " ", 2)[1]
+		if m.Get(pattern) == nil {
+			m.Set(pattern, pattern)
+			paths = append(paths, githubPath(pattern))
+		}
+	}
+	return m, paths
+}
+
+func TestMatchGithubAPI(t *testing.T) {
+	m, paths := newGithubTree()
+
+	var ps Params
+	for _, path := range paths {
+		ps = ps[:0]
+		v, redirect, substr := m.MatchParams(path, &ps)
+		if v == nil || redirect || substr != path || githubPath(v.(string)) != path {
+			t.Fatalf("match '%s' error, got %v %t %s", path, v, redirect, substr)
+		}
+		for _, p := range ps {
+			if p.Key != p.Value {
+				t.Fatalf("match '%s' params error, got %v", path, ps)
+			}
+		}
+
+		// the recursive implementation should agree
+		if rv, _, _, _ := m.recursiveMatch(path); rv != v {
+			t.Fatalf("match '%s' error, recursive match got %v, iterative match got %v", path, rv, v)
+		}
+	}
+}
+
+func TestMatchParamsAllocs(t *testing.T) {
+	m, paths := newGithubTree()
+
+	for name, m := range map[string]TestPatternMap{"tree": m, "compiled": m.Compile().(TestPatternMap)} {
+		ps := make(Params, 0, 8)
+		allocs := testing.AllocsPerRun(100, func() {
+			for _, path := range paths {
+				ps = ps[:0]
+				m.MatchParams(path, &ps)
+			}
+		})
+
+		if allocs > 0 {
+			t.Fatalf("%s: MatchParams should not allocate, got %v allocs", name, allocs)
+		}
+	}
+}
+
+func BenchmarkGithubAll(b *testing.B) {
+	m, paths := newGithubTree()
+
+	b.Run("iterative", func(b *testing.B) {
+		ps := make(Params, 0, 8)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, path := range paths {
+				ps = ps[:0]
+				m.MatchParams(path, &ps)
+			}
+		}
+	})
+
+	b.Run("compiled", func(b *testing.B) {
+		c := m.Compile().(TestPatternMap)
+		ps := make(Params, 0, 8)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, path := range paths {
+				ps = ps[:0]
+				c.MatchParams(path, &ps)
+			}
+		}
+	})
+
+	b.Run("recursive", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, path := range paths {
+				m.recursiveMatch(path)
+			}
+		}
+	})
+}
+
+func BenchmarkGithubParam(b *testing.B) {
+	m, _ := newGithubTree()
+	path := "/repos/iafon/iafon/issues/42/comments"
+
+	b.Run("iterative", func(b *testing.B) {
+		ps := make(Params, 0, 8)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ps = ps[:0]
+			m.MatchParams(path, &ps)
+		}
+	})
+
+	b.Run("recursive", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m.recursiveMatch(path)
+		}
+	})
+}
+
+func BenchmarkGithubServeHTTP(b *testing.B) {
+	r := newRouter()
+	for _, route := range githubAPI {
+		parts := strings.SplitN(route, " ", 2)
+		r.Handle(parts[0], parts[1], func(*Context) {})
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost/repos/iafon/iafon/issues/42/comments", nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(nil, req)
+	}
+}
+
+// recursiveMatch is a simplified copy of the former recursive RouteTree.Match, kept for benchmark.
+func (t *RouteTree) recursiveMatch(path string) (value interface{}, params map[string]string, redirect bool, substr string) {
+	if t.nType == cStatic {
+		len_n := len(t.text)
+		len_p := len(path)
+
+		if len_n-len_p < 1 {
+			if t.text == path[:len_n] {
+				value, params, redirect, substr = t.recursiveMatchSubTrees(path[len_n:])
+				if value != nil {
+					if substr == "" && t.value != nil {
+						value = t.value
+						redirect = false
+						substr = t.text
+					} else {
+						substr = t.text + substr
+					}
+				} else if len_n == len_p || path[len_n] == '/' {
+					value = t.value
+					substr = t.text
+				}
+			}
+		} else if len_n-len_p == 1 {
+			if t.text[len_n-1] == '/' && t.text[:len_n-1] == path {
+				if value = t.redirectValue(); value != nil {
+					redirect = true
+					substr = path
+				}
+			}
+		}
+	} else if t.nType == cParam {
+		seg_end := strings.IndexByte(path, '/')
+		if seg_end < 0 {
+			seg_end = len(path)
+		}
+
+		for end := seg_end; end > 0; end-- {
+			if end < seg_end && !t.hasSegmentTree(path[end]) {
+				continue
+			}
+
+			param := path[:end]
+
+			if t.re != nil && !t.re.MatchString(param) {
+				continue
+			}
+
+			curr_value, curr_params, curr_redirect, curr_substr := t.recursiveMatchSubTrees(path[end:])
+			if curr_value != nil {
+				curr_substr = param + curr_substr
+			} else if end == seg_end {
+				curr_value = t.value
+				curr_substr = param
+			}
+			if curr_value == nil {
+				continue
+			}
+			if curr_params == nil {
+				curr_params = make(map[string]string)
+			}
+			curr_params[t.text] = param
+
+			if value == nil || len(substr) < len(curr_substr) ||
+				(len(substr) == len(curr_substr) && redirect && !curr_redirect) {
+				value = curr_value
+				params = curr_params
+				redirect = curr_redirect
+				substr = curr_substr
+			}
+		}
+	} else if t.nType == cCatchAll {
+		value = t.value
+		substr = path
+		params = map[string]string{t.text: path}
+	}
+
+	return
+}
+
+func (t *RouteTree) recursiveMatchSubTrees(path string) (value interface{}, params map[string]string, redirect bool, substr string) {
+	for _, st := range t.trees {
+		if curr_value, curr_params, curr_redirect, curr_substr := st.recursiveMatch(path); curr_value != nil {
+			if value == nil || len(substr) < len(curr_substr) ||
+				(len(substr) == len(curr_substr) && redirect && !curr_redirect) {
+				value = curr_value
+				params = curr_params
+				redirect = curr_redirect
+				substr = curr_substr
+			}
+		}
+	}
+	return
+}
+
+func TestRouteTreeDelete(t *testing.T) {
+	patterns := []string{"/user/:id", "/user/:id/posts", "/user/admin", "/users", "/static/*filepath"}
+
+	m := &PatternMapByTree{}
+	for _, p := range patterns {
+		m.Set(p, p)
+	}
+
+	// "/user/" is a tree node, but not a pattern set
+	if m.Get("/user/") != nil || m.Delete("/user/") || m.Delete("/user/:name") || m.Delete("/static/*path") {
+		t.Fatal("pattern not set should not be deleted")
+	}
+
+	cloned := m.Clone().(TestPatternMap)
+
+	for i, p := range patterns {
+		if !cloned.Delete(p) || cloned.Get(p) != nil || cloned.Delete(p) {
+			t.Fatalf("fail to delete '%s'", p)
+		}
+		if cloned.Len() != len(patterns)-i-1 {
+			t.Fatalf("Len error after deleting '%s', got %d", p, cloned.Len())
+		}
+		for _, rest := range patterns[i+1:] {
+			if cloned.Get(rest) != rest {
+				t.Fatalf("'%s' should not be affected by deleting '%s'", rest, p)
+			}
+		}
+	}
+
+	if tree := cloned.(*PatternMapByTree).RouteTree; tree.text != "" || len(tree.trees) != 0 {
+		t.Fatal("tree should be empty after all patterns deleted")
+	}
+
+	for _, p := range patterns {
+		if m.Get(p) != p {
+			t.Fatalf("original tree should not be affected by its clone, '%s' not found", p)
+		}
+	}
+}
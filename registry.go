@@ -0,0 +1,186 @@
+package iafon
+
+import (
+	"reflect"
+	"sync"
+)
+
+// tRegistry holds controllers and middlewares used by routes of a router, so routers do not share them
+type tRegistry struct {
+	mu sync.Mutex
+
+	// registered by Router.RegisterController, by type name like "main.AController"
+	controllers map[string]*tFactory
+
+	// by the middleware used
+	middlewares map[MiddlewareInterface]*tRegisteredMiddleware
+
+	// number of middlewares used, middlewares of the same exec order are sorted by it
+	seq uint64
+}
+
+// tRegisteredMiddleware is a middleware used by routes of router
+type tRegisteredMiddleware struct {
+	factory   *tFactory
+	execOrder int16
+	seq       uint64
+}
+
+// tFactory creates instances of a controller or middleware type for requests.
+// an instance is a copy of the value registered, it is reused after its handler returns or panics, like Context.
+type tFactory struct {
+	proto reflect.Value
+
+	// reset sets instance to the value registered, without reflection if the type has only the base struct
+	reset func(inst *tInstance)
+
+	pool sync.Pool
+}
+
+// tInstance is an instance of controller or middleware, with its interfaces resolved once
+type tInstance struct {
+	elem reflect.Value
+
+	middleware MiddlewareInterface
+	wrapper    Wrapper
+
+	controller ControllerInterface
+	// the receiver of controller method
+	args []reflect.Value
+}
+
+var (
+	middlewareType = reflect.TypeOf(Middleware{})
+	controllerType = reflect.TypeOf(Controller{})
+)
+
+// newFactory returns factory of instances of v, which is a pointer to middleware or controller struct
+func newFactory(v interface{}) *tFactory {
+	ptr := reflect.ValueOf(v)
+	f := &tFactory{proto: ptr.Elem()}
+
+	t := f.proto.Type()
+
+	f.pool.New = func() interface{} {
+		p := reflect.New(t)
+		inst := &tInstance{elem: p.Elem(), args: []reflect.Value{p}}
+		inst.middleware, _ = p.Interface().(MiddlewareInterface)
+		inst.wrapper, _ = p.Interface().(Wrapper)
+		inst.controller, _ = p.Interface().(ControllerInterface)
+		return inst
+	}
+
+	only_base := t.NumField() == 1 && t.Field(0).Anonymous
+	switch {
+	case only_base && t.Field(0).Type == middlewareType:
+		base := v.(MiddlewareInterface).GetBaseMiddleware()
+		f.reset = func(inst *tInstance) {
+			*inst.middleware.GetBaseMiddleware() = *base
+		}
+	case only_base && t.Field(0).Type == controllerType:
+		base := v.(ControllerInterface).GetBaseController()
+		f.reset = func(inst *tInstance) {
+			*inst.controller.GetBaseController() = *base
+		}
+	default:
+		// fields of any type could not be copied without reflection, without generics either.
+		// Set does not allocate, it costs about 10ns more than the base struct, see BenchmarkFactoryReset
+		f.reset = func(inst *tInstance) {
+			inst.elem.Set(f.proto)
+		}
+	}
+
+	return f
+}
+
+// get returns an instance for the request of ctx
+func (f *tFactory) get(ctx *Context) *tInstance {
+	inst := f.pool.Get().(*tInstance)
+	f.reset(inst)
+
+	if inst.middleware != nil {
+		inst.middleware.GetBaseMiddleware().Context = ctx
+	} else {
+		inst.controller.GetBaseController().Context = ctx
+	}
+
+	return inst
+}
+
+// put reuses inst after request is handled
+func (f *tFactory) put(inst *tInstance) {
+	if inst.middleware != nil {
+		inst.middleware.GetBaseMiddleware().Context = nil
+	} else {
+		inst.controller.GetBaseController().Context = nil
+	}
+	f.pool.Put(inst)
+}
+
+// registerMiddleware returns the middleware m used by routes of router.
+// its exec order is decided when it is used first, by execOrder or ExecOrder of m.
+func (r *Router) registerMiddleware(m MiddlewareInterface, execOrder ...int16) *tRegisteredMiddleware {
+	r.registry.mu.Lock()
+	defer r.registry.mu.Unlock()
+
+	if reg, ok := r.registry.middlewares[m]; ok {
+		return reg
+	}
+
+	if r.registry.middlewares == nil {
+		r.registry.middlewares = make(map[MiddlewareInterface]*tRegisteredMiddleware)
+	}
+
+	r.registry.seq++
+	reg := &tRegisteredMiddleware{factory: newFactory(m), execOrder: m.GetBaseMiddleware().ExecOrder, seq: r.registry.seq}
+	if len(execOrder) > 0 {
+		reg.execOrder = execOrder[0]
+	}
+	r.registry.middlewares[m] = reg
+
+	return reg
+}
+
+// RegisterController registers controller c for routes of this router, its methods could be route handlers
+// like (*AController).Show. for each request, a copy of c is created, so fields set in c are the initial values,
+// they are copied by reflection if c has fields besides the base Controller.
+// the copy is reused by later requests after the handler returns or panics, like Context,
+// so do not keep it after that, e.g. by a goroutine started in the handler.
+func (r *Router) RegisterController(c ControllerInterface) {
+	if c == nil || reflect.TypeOf(c).Kind() != reflect.Ptr || reflect.TypeOf(c).Elem().Kind() != reflect.Struct {
+		panic("http: controller should be a pointer to struct")
+	}
+
+	r.registry.mu.Lock()
+	defer r.registry.mu.Unlock()
+
+	if r.registry.controllers == nil {
+		r.registry.controllers = make(map[string]*tFactory)
+	}
+	r.registry.controllers[reflect.TypeOf(c).Elem().String()] = newFactory(c)
+}
+
+// controllerFactory returns factory of controller type registered to this router,
+// or registered by RegisterController for all routers, nil if not registered
+func (r *Router) controllerFactory(name string) *tFactory {
+	r.registry.mu.Lock()
+	defer r.registry.mu.Unlock()
+
+	if f, ok := r.registry.controllers[name]; ok {
+		return f
+	}
+
+	registeredControllersMu.RLock()
+	value, ok := registeredControllers[name]
+	registeredControllersMu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	if r.registry.controllers == nil {
+		r.registry.controllers = make(map[string]*tFactory)
+	}
+	f := newFactory(value.Addr().Interface())
+	r.registry.controllers[name] = f
+	return f
+}
@@ -0,0 +1,699 @@
+package iafon
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RouteIssueKind is the kind of problem found by Router.Validate
+type RouteIssueKind string
+
+const (
+	// the same param name is used twice in a pattern
+	IssueDuplicateParam RouteIssueKind = "duplicate-param"
+	// route is never served, because another pattern matching the same paths is matched first,
+	// like "/user/:name" after "/user/:id"
+	IssueConflict RouteIssueKind = "conflict"
+	// some paths of route are served by another route, like "/user/admin" of "/user/:id"
+	IssueShadowed RouteIssueKind = "shadowed"
+	// route without host is hidden by route of a host, for requests of the host
+	IssueHostOverride RouteIssueKind = "host-override"
+	// params at the same position of patterns have different names, like "/user/:id" and "/user/:name/posts"
+	IssueAmbiguousParam RouteIssueKind = "ambiguous-param"
+)
+
+// IsError reports whether routes of this kind of issue could not work as expected,
+// Router.Freeze fails if any error is found.
+func (k RouteIssueKind) IsError() bool {
+	return k == IssueDuplicateParam || k == IssueConflict
+}
+
+// RouteIssue is a problem of route found by Router.Validate
+type RouteIssue struct {
+	Kind RouteIssueKind
+
+	// route having the issue and its pattern, including host
+	Route   *RouteNode
+	Pattern string
+
+	// route and pattern causing the issue, nil if the issue is about Route only
+	Other        *RouteNode
+	OtherPattern string
+
+	// request showing the issue, like "GET example.com/user/admin"
+	Request string
+
+	Message string
+}
+
+func (i RouteIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Kind, i.Message)
+}
+
+// ValidationReport is the result of Router.Validate
+type ValidationReport struct {
+	Issues []RouteIssue
+}
+
+// HasErrors reports whether any issue is an error, see RouteIssueKind.IsError
+func (r *ValidationReport) HasErrors() bool {
+	for _, issue := range r.Issues {
+		if issue.Kind.IsError() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ValidationReport) String() string {
+	str := ""
+	for _, issue := range r.Issues {
+		str += issue.String() + "\n"
+	}
+	return str
+}
+
+// tRouteEntry is a pattern of route being validated
+type tRouteEntry struct {
+	rn      *RouteNode
+	pattern string
+	host    string
+	path    string
+
+	item *tPatternListItem
+	hp   *tHostPattern
+
+	// pattern with param names removed, patterns with the same shape match the same requests
+	shape string
+
+	// a request matched by the pattern, sampled is false if no value satisfies the param constraints
+	sampleHost string
+	samplePath string
+	sampled    bool
+}
+
+// Validate checks routes of r, and reports conflicts, shadowed routes and ambiguous param names.
+// paths are sampled from patterns, and each sample is resolved the same way as a request,
+// so the report shows which route really serves it.
+// a pattern is only compared with patterns which could match the same paths, like patterns of the same first segment.
+func (r *Router) Validate() *ValidationReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.validate(r.GetRoutes())
+}
+
+func (r *Router) validate(routes RouteNodeSlice) *ValidationReport {
+	report := &ValidationReport{}
+	t := r.routeTable()
+
+	var entries []*tRouteEntry
+	for _, rn := range routes {
+		for _, pattern := range rn.load().patterns {
+			e := newRouteEntry(rn, pattern)
+			entries = append(entries, e)
+
+			names := make(map[string]bool)
+			for _, name := range patternParams(pattern) {
+				if names[name] {
+					report.Issues = append(report.Issues, RouteIssue{
+						Kind:    IssueDuplicateParam,
+						Route:   rn,
+						Pattern: pattern,
+						Message: fmt.Sprintf("param '%s' is duplicate in pattern '%s %s'", name, rn.method, pattern),
+					})
+				}
+				names[name] = true
+			}
+		}
+	}
+
+	reported := make(map[string]bool)
+	conflicts := make(map[[2]string]bool)
+
+	// sampled entries by the first segment and the number of segments of sample path,
+	// pattern without catch-all, of static first segment, only matches samples of the same key
+	by_key := make(map[tSampleKey][]*tRouteEntry)
+	for _, e := range entries {
+		if e.sampled {
+			key := tSampleKey{firstSegment(e.samplePath), strings.Count(e.samplePath, "/")}
+			by_key[key] = append(by_key[key], e)
+		}
+	}
+
+	for _, b := range entries {
+		if !b.sampled {
+			continue
+		}
+
+		candidates := entries
+		if key, ok := patternKey(b.item); ok {
+			candidates = by_key[key]
+		}
+
+		// sample of b itself first, then samples of other patterns matched by b
+		samples := []*tRouteEntry{b}
+		for _, a := range candidates {
+			if a != b && a.sampled && b.matches(a.sampleHost, a.samplePath) {
+				samples = append(samples, a)
+			}
+		}
+
+		for _, a := range samples {
+			host := a.sampleHost
+			if host == "" {
+				host = b.sampleHost
+			}
+
+			method := b.rn.method
+			if method == "*" {
+				if method = a.rn.method; method == "*" {
+					method = "GET"
+				}
+			}
+
+			var ps Params
+			req := sampleRequest(method, host, a.samplePath, b.rn.load().conditions)
+			res := r.resolve(t, req, method, host, a.samplePath, a.samplePath, &ps)
+			if res.rn == b.rn {
+				continue
+			}
+
+			other := findEntry(entries, t, res)
+			if other == nil || other.rn == b.rn {
+				continue
+			}
+
+			// routes of the same pattern with more conditions are tried first by design
+			same_conditions := conditionsKey(b.rn.load().conditions) == conditionsKey(other.rn.load().conditions)
+			if res.rn != nil && other.pattern == b.pattern && !same_conditions {
+				continue
+			}
+
+			key := b.rn.method + " " + b.pattern + " " + other.pattern
+			if reported[key] {
+				continue
+			}
+			reported[key] = true
+
+			issue := RouteIssue{
+				Route:        b.rn,
+				Pattern:      b.pattern,
+				Other:        other.rn,
+				OtherPattern: other.pattern,
+				Request:      method + " " + host + a.samplePath,
+			}
+
+			switch {
+			case b.shape == other.shape && same_conditions && (res.rn == nil || other.rn.method == b.rn.method):
+				issue.Kind = IssueConflict
+				issue.Message = fmt.Sprintf("route '%s %s' is never served, pattern '%s' of route '%s %s' matches the same paths first",
+					b.rn.method, b.pattern, other.pattern, other.rn.method, other.rn.Pattern())
+				conflicts[[2]string{b.path, other.path}] = true
+			case res.rn != nil && b.host == "" && res.rn.host != "":
+				issue.Kind = IssueHostOverride
+				issue.Message = fmt.Sprintf("route '%s %s' is hidden by route '%s %s' for host '%s'",
+					b.rn.method, b.pattern, res.rn.method, other.pattern, host)
+			case res.rn != nil:
+				issue.Kind = IssueShadowed
+				issue.Message = fmt.Sprintf("request '%s' matched by route '%s %s' is served by route '%s %s'",
+					issue.Request, b.rn.method, b.pattern, res.rn.method, other.pattern)
+			default:
+				issue.Kind = IssueShadowed
+				issue.Message = fmt.Sprintf("request '%s' matched by route '%s %s' is answered with %d, because pattern '%s' is matched first",
+					issue.Request, b.rn.method, b.pattern, res.status, other.pattern)
+			}
+
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+
+	ambiguous := make(map[[2]string]bool)
+
+	// params at the same position follow the same static text, so only entries of the same leading static text are compared
+	var prefixes []string
+	by_prefix := make(map[string][]*tRouteEntry)
+	for _, e := range entries {
+		prefix := e.item.parts[0].text
+		if by_prefix[prefix] == nil {
+			prefixes = append(prefixes, prefix)
+		}
+		by_prefix[prefix] = append(by_prefix[prefix], e)
+	}
+
+	for _, prefix := range prefixes {
+		same_prefix := by_prefix[prefix]
+		for i, a := range same_prefix {
+			for _, b := range same_prefix[i+1:] {
+				pair := [2]string{a.path, b.path}
+				if a.path > b.path {
+					pair = [2]string{b.path, a.path}
+				}
+				if ambiguous[pair] || conflicts[[2]string{a.path, b.path}] || conflicts[[2]string{b.path, a.path}] {
+					continue
+				}
+
+				name_a, name_b := ambiguousParam(a.item, b.item)
+				if name_a == "" {
+					continue
+				}
+				ambiguous[pair] = true
+
+				report.Issues = append(report.Issues, RouteIssue{
+					Kind:         IssueAmbiguousParam,
+					Route:        b.rn,
+					Pattern:      b.pattern,
+					Other:        a.rn,
+					OtherPattern: a.pattern,
+					Message: fmt.Sprintf("param '%s' of pattern '%s' is named '%s' in pattern '%s'",
+						name_b, hideMountParam(b.path), name_a, hideMountParam(a.path)),
+				})
+			}
+		}
+	}
+
+	return report
+}
+
+func newRouteEntry(rn *RouteNode, pattern string) *tRouteEntry {
+	e := &tRouteEntry{rn: rn, pattern: hideMountParam(pattern)}
+	e.host, e.path = splitHostPattern(pattern)
+	e.item = newMapItem(e.path, rn)
+
+	e.sampled = true
+
+	shape, sample := partsShape(e.item.parts, "")
+	e.shape, e.samplePath = shape, sample
+	e.sampled = e.sampled && sample != "" && cleanPath(sample) == sample
+
+	if isHostPattern(e.host) {
+		e.hp = newHostPattern(e.host)
+		labels := make([]string, len(e.hp.labels))
+		samples := make([]string, len(e.hp.labels))
+		for i, parts := range e.hp.labels {
+			labels[i], samples[i] = partsShape(parts, "w")
+			e.sampled = e.sampled && samples[i] != ""
+		}
+		e.shape = strings.Join(labels, ".") + e.shape
+		e.sampleHost = strings.Join(samples, ".")
+	} else {
+		e.shape = e.host + e.shape
+		e.sampleHost = e.host
+	}
+
+	return e
+}
+
+// sampleRequest returns request of method, host and path, which satisfies conditions
+func sampleRequest(method, host, path string, conditions []RouteCondition) *http.Request {
+	req := &http.Request{Method: method, Host: host, URL: &url.URL{Path: path}, Header: http.Header{}}
+
+	query := url.Values{}
+	for _, c := range conditions {
+		value := c.values[0]
+		switch c.kind {
+		case cConditionHeader:
+			if value == "" {
+				value = "1"
+			}
+			req.Header.Set(c.key, value)
+		case cConditionQuery:
+			query.Set(c.key, value)
+		case cConditionAccept:
+			req.Header.Set("Accept", value)
+		case cConditionContentType:
+			req.Header.Set("Content-Type", strings.Replace(value, "*", "x", -1))
+		}
+	}
+	req.URL.RawQuery = query.Encode()
+
+	return req
+}
+
+// sampleValues are tried as value of param, the first one satisfying the constraint is used
+var sampleValues = []string{"x", "1", "a", "x1", "ab", "0123456789abcdef", "123e4567-e89b-12d3-a456-426614174000", "a-b", "A", "_"}
+
+// partsShape returns shape of parts without param names, and a sample matched by parts,
+// sample is empty if no value satisfies a param constraint.
+// catch-all is sampled as catch_all.
+func partsShape(parts []tSubPattern, catch_all string) (shape, sample string) {
+	var b, s strings.Builder
+
+	for _, part := range parts {
+		switch part.pType {
+		case cSubPatternStatic:
+			b.WriteString(part.text)
+			s.WriteString(part.text)
+		case cSubPatternCatchAll:
+			b.WriteString("*")
+			if catch_all == "" {
+				catch_all = "x"
+			}
+			s.WriteString(catch_all)
+		default:
+			b.WriteString(":")
+			value := ""
+			if part.re == nil {
+				value = sampleValues[0]
+			} else {
+				b.WriteString("<" + constraintExpr(part) + ">")
+				for _, v := range sampleValues {
+					if part.re.MatchString(v) {
+						value = v
+						break
+					}
+				}
+			}
+			if value == "" {
+				return b.String(), ""
+			}
+			s.WriteString(value)
+		}
+	}
+
+	return b.String(), s.String()
+}
+
+// matches reports whether pattern of e matches request of host and path, host "" is any host
+func (e *tRouteEntry) matches(host, path string) bool {
+	switch {
+	case e.host == "":
+	case e.hp != nil:
+		var ps Params
+		if host == "" || !e.hp.match(host, &ps) {
+			return false
+		}
+	case e.host != host:
+		return false
+	}
+
+	return e.matchesPath(path)
+}
+
+// matchesPath reports whether path pattern of e matches path exactly
+func (e *tRouteEntry) matchesPath(path string) bool {
+	var ps Params
+	end, matched := e.item.matchParts(0, path, 0, &ps, cListMatchExact)
+	return matched && end == len(path)
+}
+
+// findEntry returns the entry of the pattern matched and the route serving the request,
+// or the entry of the pattern matched if no route serves the request
+func findEntry(entries []*tRouteEntry, t *tRouteTable, res tResolution) *tRouteEntry {
+	if res.m == nil {
+		return nil
+	}
+	for _, e := range entries {
+		if (res.rn == nil || e.rn == res.rn) && t.matcher.Get(e.path) == res.m {
+			return e
+		}
+	}
+	return nil
+}
+
+// firstSegment returns the first segment of path, like "/user" of "/user/42"
+func firstSegment(path string) string {
+	if pos := strings.IndexByte(path[1:], '/'); pos >= 0 {
+		return path[:pos+1]
+	}
+	return path
+}
+
+// tSampleKey is the first segment and the number of segments of path
+type tSampleKey struct {
+	segment  string
+	segments int
+}
+
+// patternKey returns key of paths matched by pattern item,
+// ok is false if paths have different keys, because of param in the first segment or catch-all
+func patternKey(item *tPatternListItem) (key tSampleKey, ok bool) {
+	text := item.parts[0].text
+	if pos := strings.IndexByte(text[1:], '/'); pos >= 0 {
+		key.segment = text[:pos+1]
+	} else if len(item.parts) == 1 {
+		key.segment = text
+	} else {
+		return key, false
+	}
+
+	// param value does not contain /
+	for _, part := range item.parts {
+		if part.pType == cSubPatternCatchAll {
+			return key, false
+		}
+		if part.pType == cSubPatternStatic {
+			key.segments += strings.Count(part.text, "/")
+		}
+	}
+	return key, true
+}
+
+// ambiguousParam returns names of params at the same position of a and b, if they have different names
+func ambiguousParam(a, b *tPatternListItem) (name_a, name_b string) {
+	for k := 0; k < len(a.parts) && k < len(b.parts); k++ {
+		pa, pb := a.parts[k], b.parts[k]
+		if pa.pType != pb.pType {
+			return "", ""
+		}
+		switch pa.pType {
+		case cSubPatternStatic:
+			if pa.text != pb.text {
+				return "", ""
+			}
+		default:
+			if constraintExpr(pa) != constraintExpr(pb) {
+				return "", ""
+			}
+			if pa.text != pb.text {
+				return pa.text, pb.text
+			}
+		}
+	}
+	return "", ""
+}
+
+// RouteExplanation tells how Router handles a request, returned by Router.Explain
+type RouteExplanation struct {
+	Method string
+	Host   string
+	Path   string
+
+	// route serving the request, nil if the request is not served by a route
+	Route *RouteNode
+	// pattern matched, including host
+	Pattern string
+	Params  Params
+
+	// 200 if the request is served by Route, otherwise 404, 405, 204 of automatic OPTIONS or the redirect code
+	Status int
+	// path to redirect to
+	Location string
+	// allowed methods of 405 and automatic OPTIONS
+	Allow string
+
+	// why Route wins, or why no route serves the request
+	Reasons []string
+}
+
+func (e *RouteExplanation) String() string {
+	str := fmt.Sprintf("%s %s%s => %d", e.Method, e.Host, e.Path, e.Status)
+	if e.Route != nil {
+		str += fmt.Sprintf(" '%s %s'", e.Route.method, e.Pattern)
+	}
+	if e.Location != "" {
+		str += " " + e.Location
+	}
+	str += "\n"
+	for _, reason := range e.Reasons {
+		str += "  " + reason + "\n"
+	}
+	return str
+}
+
+// Explain tells which route serves request of method, host and path, and why.
+// it resolves the request the same way as ServeHTTP, without calling any handler.
+// the request has no header and query, see ExplainRequest for routes with conditions.
+func (r *Router) Explain(method, host, path string) *RouteExplanation {
+	return r.ExplainRequest(&http.Request{
+		Method: method,
+		Host:   host,
+		URL:    &url.URL{Path: path},
+		Header: http.Header{},
+	})
+}
+
+// ExplainRequest is like Explain, conditions of routes are checked with header and query of req
+func (r *Router) ExplainRequest(req *http.Request) *RouteExplanation {
+	method, host, path := req.Method, stripHostPort(req.Host), req.URL.Path
+	e := &RouteExplanation{Method: method, Host: host, Path: path}
+
+	t := r.routeTable()
+	clean := cleanPath(path)
+	if clean != path {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("path is cleaned to '%s'", clean))
+	}
+
+	res := r.resolve(t, req, method, host, path, clean, &e.Params)
+
+	var entries []*tRouteEntry
+	for _, rn := range r.GetRoutes() {
+		for _, pattern := range rn.load().patterns {
+			entries = append(entries, newRouteEntry(rn, pattern))
+		}
+	}
+
+	// pattern matched by matcher, routes of all hosts and methods are found by the pattern
+	var matched *tRouteEntry
+	if res.m != nil {
+		for _, entry := range entries {
+			if t.matcher.Get(entry.path) == res.m {
+				matched = entry
+				break
+			}
+		}
+	}
+
+	if matched == nil {
+		e.Reasons = append(e.Reasons, "no pattern matches path")
+	} else if matched.matchesPath(clean) {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("pattern '%s' matches path", hideMountParam(matched.path)))
+
+		// other patterns matching path are tried after the pattern matched
+		seen := map[string]bool{matched.path: true}
+		for _, entry := range entries {
+			if seen[entry.path] || !entry.matchesPath(clean) {
+				continue
+			}
+			seen[entry.path] = true
+			e.Reasons = append(e.Reasons, fmt.Sprintf("pattern '%s' also matches path, but %s",
+				hideMountParam(entry.path), explainBefore(matched.item, entry.item)))
+		}
+	} else {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("pattern '%s' matches path without the trailing slash, or a prefix of path", hideMountParam(matched.path)))
+	}
+
+	if res.rn != nil {
+		e.Route = res.rn
+		e.Status = http.StatusOK
+		if entry := findEntry(entries, t, res); entry != nil {
+			e.Pattern = entry.pattern
+		}
+
+		switch {
+		case res.rn.host == "" && res.m.shouldMatchHost:
+			e.Reasons = append(e.Reasons, "no route of host '"+host+"' handles the request, route without host is used")
+		case res.rn.host == "":
+			e.Reasons = append(e.Reasons, "route without host")
+		case isHostPattern(res.rn.host):
+			e.Reasons = append(e.Reasons, fmt.Sprintf("host matches host pattern '%s', which takes precedence over routes without host", res.rn.host))
+		default:
+			e.Reasons = append(e.Reasons, fmt.Sprintf("host matches '%s' exactly, which takes precedence over host patterns and routes without host", res.rn.host))
+		}
+
+		switch {
+		case res.head:
+			e.Reasons = append(e.Reasons, "no HEAD route, HEAD request is served by GET route without response body")
+		case res.rn.method == "*" && method != "*":
+			e.Reasons = append(e.Reasons, "no route of method "+method+", route of any method is used")
+		default:
+			e.Reasons = append(e.Reasons, "route of method "+method)
+		}
+
+		if len(res.rn.load().conditions) > 0 {
+			e.Reasons = append(e.Reasons, "conditions are satisfied: "+conditionsKey(res.rn.load().conditions)+
+				", routes with more conditions are tried first")
+		}
+
+		return e
+	}
+
+	e.Status = res.status
+	e.Location = res.location
+	e.Allow = res.allow
+
+	switch {
+	case res.location != "":
+		e.Reasons = append(e.Reasons, fmt.Sprintf("path does not match pattern exactly, redirected to '%s' by path policy", res.location))
+	case res.status == http.StatusNoContent:
+		e.Reasons = append(e.Reasons, "no route of method OPTIONS, answered with allowed methods "+res.allow)
+	case res.status == http.StatusNotAcceptable || res.status == http.StatusUnsupportedMediaType:
+		e.Reasons = append(e.Reasons, fmt.Sprintf("routes of method %s are found, but conditions of them are not satisfied", method))
+	case res.status == http.StatusMethodNotAllowed:
+		e.Reasons = append(e.Reasons, fmt.Sprintf("no route of method %s for pattern '%s', allowed methods are %s", method, matched.path, res.allow))
+	case matched != nil && res.m != nil:
+		e.Reasons = append(e.Reasons, "no route of host '"+host+"' for the pattern, conditions of routes are not satisfied, or path policy replies 404")
+	}
+
+	return e
+}
+
+// constraintExpr returns the regular expression of param constraint, shorthands are expanded
+func constraintExpr(part tSubPattern) string {
+	if part.re == nil {
+		return ""
+	}
+	return part.re.String()
+}
+
+// explainBefore tells why pattern of a is tried before b, both of them match the same path
+func explainBefore(a, b *tPatternListItem) string {
+	ai, bi := 0, 0 // index of parts
+	ao, bo := 0, 0 // offset in static part
+
+	for {
+		for ai < len(a.parts) && a.parts[ai].pType == cSubPatternStatic && ao == len(a.parts[ai].text) {
+			ai, ao = ai+1, 0
+		}
+		for bi < len(b.parts) && b.parts[bi].pType == cSubPatternStatic && bo == len(b.parts[bi].text) {
+			bi, bo = bi+1, 0
+		}
+
+		if ai == len(a.parts) || bi == len(b.parts) {
+			break
+		}
+
+		pa, pb := a.parts[ai], b.parts[bi]
+
+		if pa.pType == cSubPatternStatic && pb.pType == cSubPatternStatic {
+			if pa.text[ao] != pb.text[bo] {
+				break
+			}
+			ao, bo = ao+1, bo+1
+			continue
+		}
+
+		if pa.equal(pb) {
+			ai, bi = ai+1, bi+1
+			continue
+		}
+
+		pa.text = pa.text[ao:]
+		pb.text = pb.text[bo:]
+
+		if pa.priority() < pb.priority() {
+			return fmt.Sprintf("%s is tried before %s", describePart(pa), describePart(pb))
+		}
+		if pa.priority() == pb.priority() {
+			return fmt.Sprintf("%s is added before %s", describePart(pa), describePart(pb))
+		}
+		break
+	}
+
+	return "it is tried after '" + hideMountParam(a.pattern) + "'"
+}
+
+func describePart(part tSubPattern) string {
+	switch {
+	case part.pType == cSubPatternStatic:
+		return "static text '" + part.text + "'"
+	case part.pType == cSubPatternCatchAll:
+		return "catch-all '" + hideMountParam("*"+part.text) + "'"
+	case part.re != nil:
+		return "constrained param ':" + part.text + "<" + part.constraint + ">'"
+	default:
+		return "param ':" + part.text + "'"
+	}
+}
@@ -0,0 +1,289 @@
+package iafon
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RouteCondition is a condition of request besides host, path and method, for choosing route.
+// several routes could be added for the same host, path and method with different conditions,
+// routes with more conditions are tried first, then in the order of adding.
+type RouteCondition struct {
+	kind   tConditionKind
+	key    string
+	values []string
+}
+
+type tConditionKind byte
+
+const (
+	cConditionHeader tConditionKind = iota
+	cConditionQuery
+	cConditionAccept
+	cConditionContentType
+)
+
+// MatchHeader is satisfied if header key of request is value, or header key is present if value is empty
+func MatchHeader(key, value string) RouteCondition {
+	return RouteCondition{kind: cConditionHeader, key: http.CanonicalHeaderKey(key), values: []string{value}}
+}
+
+// MatchQuery is satisfied if query param key of request is value, or query param key is present if value is empty,
+// like MatchQuery("format", "csv") for "?format=csv"
+func MatchQuery(key, value string) RouteCondition {
+	return RouteCondition{kind: cConditionQuery, key: key, values: []string{value}}
+}
+
+// MatchAccept is satisfied if Accept header of request accepts any of media types,
+// like MatchAccept("application/vnd.acme.v2+json"). request without Accept header accepts any media type,
+// but routes whose media type is listed in Accept header exactly are tried first, then routes satisfied by
+// wildcard like "*/*" or missing Accept header, so a route without conditions could be the default version.
+// if all routes are rejected by Accept header, 406 is replied.
+func MatchAccept(media_types ...string) RouteCondition {
+	return RouteCondition{kind: cConditionAccept, values: lowerMediaTypes(media_types)}
+}
+
+// MatchContentType is satisfied if Content-Type header of request is any of media types,
+// media type could be like "text/*". if all routes are rejected by Content-Type header, 415 is replied.
+func MatchContentType(media_types ...string) RouteCondition {
+	return RouteCondition{kind: cConditionContentType, values: lowerMediaTypes(media_types)}
+}
+
+func lowerMediaTypes(media_types []string) []string {
+	if len(media_types) == 0 {
+		panic("route: media type of condition should not be empty")
+	}
+	values := make([]string, len(media_types))
+	for i, t := range media_types {
+		if strings.IndexByte(t, '/') <= 0 {
+			panic("route: invalid media type of condition " + t)
+		}
+		values[i] = strings.ToLower(t)
+	}
+	return values
+}
+
+func (c RouteCondition) String() string {
+	switch c.kind {
+	case cConditionHeader:
+		return "header " + c.key + "=" + c.values[0]
+	case cConditionQuery:
+		return "query " + c.key + "=" + c.values[0]
+	case cConditionAccept:
+		return "accept " + strings.Join(c.values, ",")
+	default:
+		return "content-type " + strings.Join(c.values, ",")
+	}
+}
+
+// check returns 0 if req satisfies c, otherwise the status replied if all routes are rejected.
+// if strict, Accept header should list media type of c exactly.
+func (c RouteCondition) check(req *http.Request, strict bool) int {
+	switch c.kind {
+	case cConditionHeader:
+		values, ok := req.Header[c.key]
+		if !ok || (c.values[0] != "" && values[0] != c.values[0]) {
+			return http.StatusNotFound
+		}
+	case cConditionQuery:
+		values, ok := req.URL.Query()[c.key]
+		if !ok || (c.values[0] != "" && values[0] != c.values[0]) {
+			return http.StatusNotFound
+		}
+	case cConditionAccept:
+		if !acceptsAny(req.Header.Get("Accept"), c.values, strict) {
+			return http.StatusNotAcceptable
+		}
+	case cConditionContentType:
+		media_type, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if err != nil || !matchesMediaType(c.values, media_type) {
+			return http.StatusUnsupportedMediaType
+		}
+	}
+	return 0
+}
+
+// acceptsAny reports whether Accept header accepts any of media types, wildcard is not used if strict
+func acceptsAny(accept string, media_types []string, strict bool) bool {
+	if accept == "" {
+		return !strict
+	}
+
+	for _, r := range strings.Split(accept, ",") {
+		media_range, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q <= 0 {
+			continue
+		}
+		if strict && strings.HasSuffix(media_range, "/*") {
+			continue
+		}
+		for _, t := range media_types {
+			if matchesMediaType([]string{media_range}, t) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchesMediaType reports whether media type t is matched by any of ranges, like "*/*" or "text/*"
+func matchesMediaType(ranges []string, t string) bool {
+	for _, r := range ranges {
+		if r == t || r == "*/*" || (strings.HasSuffix(r, "/*") && strings.HasPrefix(t, r[:len(r)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionsKey returns the same key for the same conditions in any order
+func conditionsKey(conditions []RouteCondition) string {
+	keys := make([]string, len(conditions))
+	for i, c := range conditions {
+		keys[i] = c.String()
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "; ")
+}
+
+// When adds conditions for choosing this route after it is added, see RouteCondition.
+// the route is checked for duplicate when it is added, before When is called, so adding it panics if
+// the route of the same pattern without conditions is added already, pass conditions to Handle instead.
+func (rn *RouteNode) When(conditions ...RouteCondition) *RouteNode {
+	// conditions in published state are never modified, use a copy
+	conditions = append(append([]RouteCondition(nil), rn.load().conditions...), conditions...)
+
+	if rn.group == nil {
+		rn.update(func(s *tRouteState) {
+			s.conditions = conditions
+		})
+		return rn
+	}
+
+	rn.group.router.updateRoutes(func(t *tRouteTable) {
+		t.updateConditions(rn, conditions)
+	})
+
+	return rn
+}
+
+// updateConditions replaces conditions of rn, rn is reordered among routes of the same host, path and method
+func (t *tRouteTable) updateConditions(rn *RouteNode, conditions []RouteCondition) {
+	old := rn.load()
+
+	for _, raw_pattern := range old.patterns {
+		host, pattern := splitHostPattern(raw_pattern)
+
+		v := t.matcher.Get(pattern)
+		if v == nil {
+			continue
+		}
+
+		// values in published table are never modified, modify a copy
+		m := v.(*tMap_Host_Method_RouteNode).clone()
+		m.remove(host, rn)
+		t.matcher.Set(pattern, m)
+	}
+
+	rn.update(func(s *tRouteState) {
+		s.patterns = nil
+		s.conditions = conditions
+	})
+
+	// the table is discarded if panic, so does the change of rn
+	defer func() {
+		if p := recover(); p != nil {
+			rn.state.Store(old)
+			panic(p)
+		}
+	}()
+
+	for _, raw_pattern := range old.patterns {
+		t.addPattern(rn, raw_pattern)
+	}
+}
+
+// route returns the first route of method whose conditions are satisfied by req, or route of any method.
+// routes are tried with strict Accept first, see MatchAccept.
+// if no route is found because of conditions, rejected is the status to reply.
+func (m tMap_Method_RouteNode) route(method string, req *http.Request) (rn *RouteNode, rejected int) {
+	for _, candidates := range [2][]*RouteNode{m[method], m["*"]} {
+		if len(candidates) == 1 && len(candidates[0].load().conditions) == 0 {
+			return candidates[0], 0
+		}
+		for _, strict := range [2]bool{true, false} {
+			for _, rn := range candidates {
+				status := rn.checkConditions(req, strict)
+				if status == 0 {
+					return rn, 0
+				}
+				if !strict && rejected == 0 {
+					rejected = status
+				}
+			}
+		}
+	}
+	return nil, rejected
+}
+
+// checkConditions returns 0 if req satisfies all conditions of rn, see RouteCondition.check
+func (rn *RouteNode) checkConditions(req *http.Request, strict bool) int {
+	for _, c := range rn.load().conditions {
+		if status := c.check(req, strict); status != 0 {
+			return status
+		}
+	}
+	return 0
+}
+
+// add adds rn to routes of its method, routes with more conditions are tried first
+func (m tMap_Method_RouteNode) add(rn *RouteNode, pattern string) {
+	candidates := m[rn.method]
+
+	conditions := rn.load().conditions
+	key := conditionsKey(conditions)
+	for _, c := range candidates {
+		if conditionsKey(c.load().conditions) == key {
+			if key != "" {
+				panic(fmt.Sprintf("http: duplicate route '%s %s' when %s", rn.method, pattern, key))
+			}
+			panic(fmt.Sprintf("http: duplicate route '%s %s'", rn.method, pattern))
+		}
+	}
+
+	i := len(candidates)
+	for i > 0 && len(candidates[i-1].load().conditions) < len(conditions) {
+		i--
+	}
+
+	// slices in published table are never modified, modify a copy
+	added := make([]*RouteNode, 0, len(candidates)+1)
+	added = append(added, candidates[:i]...)
+	added = append(added, rn)
+	added = append(added, candidates[i:]...)
+	m[rn.method] = added
+}
+
+// remove removes rn from routes of its method, it reports whether rn is found
+func (m tMap_Method_RouteNode) remove(rn *RouteNode) bool {
+	candidates := m[rn.method]
+	for i, c := range candidates {
+		if c == rn {
+			if len(candidates) == 1 {
+				delete(m, rn.method)
+			} else {
+				m[rn.method] = append(candidates[:i:i], candidates[i+1:]...)
+			}
+			return true
+		}
+	}
+	return false
+}
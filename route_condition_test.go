@@ -0,0 +1,131 @@
+package iafon
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestAcceptsAny(t *testing.T) {
+	var tests = []struct {
+		accept   string
+		types    []string
+		strict   bool
+		expected bool
+	}{
+		{"", []string{"application/json"}, false, true},
+		{"", []string{"application/json"}, true, false},
+		{"application/json", []string{"application/json"}, true, true},
+		{"Application/JSON; charset=utf-8", []string{"application/json"}, true, true},
+		{"text/html, */*;q=0.8", []string{"application/json"}, false, true},
+		{"text/html, */*;q=0.8", []string{"application/json"}, true, false},
+		{"application/*", []string{"application/vnd.acme.v2+json"}, false, true},
+		{"application/vnd.acme.v1+json", []string{"application/vnd.acme.v2+json"}, false, false},
+		{"application/json;q=0", []string{"application/json"}, false, false},
+		{"text/*", []string{"application/json", "text/csv"}, false, true},
+	}
+
+	for _, test := range tests {
+		if acceptsAny(test.accept, test.types, test.strict) != test.expected {
+			t.Fatalf("accept error. Accept: '%s', types: %v, strict: %v, expected: %v", test.accept, test.types, test.strict, test.expected)
+		}
+	}
+}
+
+func TestRouteCondition(t *testing.T) {
+	var echo string
+
+	r := newRouter()
+
+	// routes with conditions are added after the route without conditions
+	r.GET("/api/user", func(c *Context) { echo = "v1" })
+	r.GET("/api/user", func(c *Context) { echo = "v2" }, MatchAccept("application/vnd.acme.v2+json"))
+	r.Some([]string{"GET"}, "/api/user", func(c *Context) { echo = "csv" }, MatchQuery("format", "csv"))
+
+	r.Group("/upload", MatchContentType("application/json"), func(g *RouteGroup) {
+		g.POST("", func(c *Context) { echo = "json" })
+	})
+	r.POST("/upload", func(c *Context) { echo = "form" }).When(MatchContentType("multipart/*"))
+
+	r.GET("/export", func(c *Context) { echo = "export" }).When(MatchAccept("text/csv"), MatchHeader("X-Token", ""))
+
+	var tests = []struct {
+		method, path string
+		header       map[string]string
+		code         int
+		expected     string
+	}{
+		{"GET", "/api/user", nil, 0, "v1"},
+		{"GET", "/api/user", map[string]string{"Accept": "*/*"}, 0, "v1"},
+		{"GET", "/api/user", map[string]string{"Accept": "application/vnd.acme.v2+json"}, 0, "v2"},
+		{"GET", "/api/user?format=csv", nil, 0, "csv"},
+		{"POST", "/upload", map[string]string{"Content-Type": "application/json; charset=utf-8"}, 0, "json"},
+		{"POST", "/upload", map[string]string{"Content-Type": "multipart/form-data; boundary=x"}, 0, "form"},
+		{"POST", "/upload", map[string]string{"Content-Type": "text/plain"}, 415, ""},
+		{"GET", "/export", map[string]string{"Accept": "text/csv", "X-Token": "1"}, 0, "export"},
+		{"GET", "/export", map[string]string{"Accept": "text/html", "X-Token": "1"}, 406, ""},
+		{"GET", "/export", map[string]string{"Accept": "text/csv"}, 404, ""},
+	}
+
+	for _, test := range tests {
+		echo = ""
+
+		req, _ := http.NewRequest(test.method, "http://localhost"+test.path, nil)
+		for key, value := range test.header {
+			req.Header.Set(key, value)
+		}
+		w := &MockResponseWriter{header: http.Header{}}
+		r.ServeHTTP(w, req)
+
+		if w.code != test.code || echo != test.expected {
+			t.Fatalf("route condition error. req: %s %s %v, expected: %d %s, got: %d %s",
+				test.method, test.path, test.header, test.code, test.expected, w.code, echo)
+		}
+	}
+
+	if report := r.Validate(); len(report.Issues) != 0 {
+		t.Fatal("routes with different conditions should not be reported, got:", report)
+	}
+
+	defer func() {
+		if p := recover(); p != "http: duplicate route 'GET /api/user' when query format=csv" {
+			t.Fatal("adding route with the same conditions should panic, got:", p)
+		}
+	}()
+	r.Group(MatchQuery("format", "csv")).GET("/api/user", func(c *Context) {})
+}
+
+func TestWhenWhileServingConcurrently(t *testing.T) {
+	r := newRouter()
+	r.GET("/when", func(*Context) {})
+	rn := r.GET("/when", func(*Context) {}, MatchQuery("v", "0"))
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		req, _ := http.NewRequest("GET", "http://localhost/when?v=0", nil)
+		r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+		close(started)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+			}
+		}
+	}()
+
+	<-started
+	for i := 1; i <= 20; i++ {
+		rn.When(MatchHeader("X-Test", strconv.Itoa(i)))
+	}
+	close(done)
+	<-served
+
+	if n := len(rn.load().conditions); n != 21 {
+		t.Fatal("route should have 21 conditions, got:", n)
+	}
+}
@@ -0,0 +1,208 @@
+package iafon
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// RouteInfo describes a route for tools, see RouteNodeSlice.JSON
+type RouteInfo struct {
+	Method string `json:"method"`
+	Host   string `json:"host,omitempty"`
+	// pattern added, group prefix included
+	Pattern string `json:"pattern"`
+	// all patterns matched, including expanded optional segments and aliases
+	Patterns []string    `json:"patterns"`
+	Name     string      `json:"name,omitempty"`
+	Handler  HandlerInfo `json:"handler"`
+	// middlewares in the order of execution
+	Middlewares []MiddlewareInfo `json:"middlewares,omitempty"`
+}
+
+// HandlerInfo describes the main handler of route
+type HandlerInfo struct {
+	// "http.Handler", "iafon.Handler" or "controller"
+	Kind string `json:"kind"`
+	// function or type name without package, like "(*AController).Show"
+	Name string `json:"name"`
+}
+
+// MiddlewareInfo describes a middleware used by route
+type MiddlewareInfo struct {
+	Name      string `json:"name"`
+	ExecOrder int16  `json:"exec_order"`
+	// middlewares of negative exec order run after the main handler
+	AfterHandler bool `json:"after_handler,omitempty"`
+	// middleware wraps the handlers after it, see Wrapper
+	Wrapper bool `json:"wrapper,omitempty"`
+	// middleware runs only if its condition is satisfied, see RouteGroup.UseMiddlewareIf
+	Conditional bool `json:"conditional,omitempty"`
+}
+
+// Info returns description of this route
+func (rn *RouteNode) Info() RouteInfo {
+	s := rn.load()
+	info := RouteInfo{
+		Method:   rn.method,
+		Host:     rn.host,
+		Pattern:  rn.Pattern(),
+		Patterns: make([]string, len(s.patterns)),
+		Name:     rn.name,
+	}
+	for i, pattern := range s.patterns {
+		info.Patterns[i] = hideMountParam(pattern)
+	}
+
+	after_handler := false
+	for _, h := range s.handlers {
+		if h.hType != cHTYPE_MIDDLEWARE {
+			info.Handler = HandlerInfo{Kind: h.kind(), Name: h.name()}
+			after_handler = true
+			continue
+		}
+
+		info.Middlewares = append(info.Middlewares, MiddlewareInfo{
+			Name:         h.name(),
+			ExecOrder:    h.execOrder,
+			AfterHandler: after_handler,
+			Wrapper:      h.wrapper,
+			Conditional:  h.cond != nil,
+		})
+	}
+
+	return info
+}
+
+// Info returns description of routes, in the order of s
+func (s RouteNodeSlice) Info() []RouteInfo {
+	infos := make([]RouteInfo, len(s))
+	for i, rn := range s {
+		infos[i] = rn.Info()
+	}
+	return infos
+}
+
+// JSON returns routes as indented JSON array of RouteInfo, like GetRoutes().JSON()
+func (s RouteNodeSlice) JSON() ([]byte, error) {
+	return json.MarshalIndent(s.Info(), "", "  ")
+}
+
+func (h *tMixHandler) kind() string {
+	switch h.hType {
+	case cHTYPE_HTTP_HANDLER:
+		return "http.Handler"
+	case cHTYPE_IAFON_HANDLER:
+		return "iafon.Handler"
+	case cHTYPE_CONTROLLER:
+		return "controller"
+	default:
+		return "middleware"
+	}
+}
+
+// name returns function name of handler, or type name if handler is not a function
+func (h *tMixHandler) name() string {
+	var v reflect.Value
+	switch h.hType {
+	case cHTYPE_HTTP_HANDLER:
+		v = reflect.ValueOf(h.httpHandler)
+	case cHTYPE_IAFON_HANDLER:
+		v = reflect.ValueOf(h.iafonHandler)
+	case cHTYPE_CONTROLLER:
+		v = h.controllerMethod
+	default:
+		switch m := h.factory.proto.Interface().(type) {
+		case tWrapFunc:
+			v = reflect.ValueOf(m.f)
+		case tHTTPMiddleware:
+			v = reflect.ValueOf(m.f)
+		default:
+			return typeName(h.factory.proto.Type())
+		}
+	}
+
+	if v.Kind() == reflect.Func {
+		if f := runtime.FuncForPC(v.Pointer()); f != nil {
+			return funcName(f.Name())
+		}
+	}
+	return typeName(v.Type())
+}
+
+// funcName removes package path of function name from runtime.FuncForPC,
+// "github.com/a/b.(*AController).Show" to "(*AController).Show".
+// dots in the last element of package path are escaped by runtime, like "gopkg.in/yaml%2ev2.F",
+// so package path ends at the first dot after the last slash. type arguments like "[...]" are not searched.
+func funcName(name string) string {
+	path := name
+	if pos := strings.IndexByte(path, '['); pos >= 0 {
+		path = path[:pos]
+	}
+	start := strings.LastIndexByte(path, '/') + 1
+	if pos := strings.IndexByte(path[start:], '.'); pos >= 0 {
+		return name[start+pos+1:]
+	}
+	return name
+}
+
+// typeName returns name of t without package path, like "*AMiddleware".
+// unnamed type is returned as t.String(), like "func(*iafon.Context)".
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		return "*" + typeName(t.Elem())
+	}
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return t.String()
+}
+
+// RouteTree returns the tree matching paths of routes, for RouteTree.DOT.
+// it returns nil if matcher of router is not PatternMapByTree, see SetMatcher.
+func (r *Router) RouteTree() *RouteTree {
+	switch m := r.routeTable().matcher.(type) {
+	case *PatternMapByTree:
+		return &m.RouteTree
+	case *tCompiledTree:
+		return &m.tree.RouteTree
+	}
+	return nil
+}
+
+// DOT returns the tree in Graphviz DOT language, nodes with value are drawn with double border.
+// nodes are numbered in depth first order, so trees of the same patterns get the same output.
+func (t *RouteTree) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph RouteTree {\n")
+	b.WriteString("\tnode [shape=box, fontname=monospace];\n")
+
+	id := 0
+	var write func(t *RouteTree) int
+	write = func(t *RouteTree) int {
+		n := id
+		id++
+
+		attrs := "label=" + dotQuote(t.label())
+		if t.value != nil {
+			attrs += ", peripheries=2"
+		}
+		fmt.Fprintf(&b, "\tn%d [%s];\n", n, attrs)
+
+		for _, st := range t.trees {
+			fmt.Fprintf(&b, "\tn%d -> n%d;\n", n, write(st))
+		}
+		return n
+	}
+	write(t)
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotQuote returns s as DOT string, only quote and backslash are escaped
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,121 @@
+package iafon
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func routeExportTestHandler(*Context) {}
+
+func TestRouteInfo(t *testing.T) {
+	RegisterController(&TestController{})
+
+	r := newRouter()
+	r.GET("/controller(/:id)?", (*TestController).Index).Name("controller").
+		UseMiddleware(&TestMiddleware{}, 10).
+		UseMiddleware(&TestMiddleware1{}, -1)
+	r.GET("/func", routeExportTestHandler).UseMiddleware(&TestMiddleware{})
+	r.GET("/http", http.NotFoundHandler())
+
+	data, err := r.GetRoutes().JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var infos []RouteInfo
+	if err := json.Unmarshal(data, &infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 {
+		t.Fatal("3 routes should be exported, got:", string(data))
+	}
+
+	c := infos[0]
+	if c.Pattern != "/controller(/:id)?" || len(c.Patterns) != 2 || c.Name != "controller" ||
+		c.Handler != (HandlerInfo{Kind: "controller", Name: "(*TestController).Index"}) {
+		t.Fatal("route info of controller error, got:", string(data))
+	}
+	if len(c.Middlewares) != 2 ||
+		c.Middlewares[0] != (MiddlewareInfo{Name: "TestMiddleware", ExecOrder: 10}) ||
+		c.Middlewares[1] != (MiddlewareInfo{Name: "TestMiddleware1", ExecOrder: -1, AfterHandler: true}) {
+		t.Fatal("middlewares of route info error, got:", string(data))
+	}
+
+	if infos[1].Handler != (HandlerInfo{Kind: "iafon.Handler", Name: "routeExportTestHandler"}) {
+		t.Fatal("route info of function error, got:", infos[1].Handler)
+	}
+	if infos[2].Handler != (HandlerInfo{Kind: "http.Handler", Name: "NotFound"}) {
+		t.Fatal("route info of http.Handler error, got:", infos[2].Handler)
+	}
+}
+
+func TestHandlerName(t *testing.T) {
+	var funcs = []struct {
+		name     string
+		expected string
+	}{
+		{"github.com/a/b.(*AController).Show", "(*AController).Show"},
+		{"main.index", "index"},
+		{"gopkg.in/yaml%2ev2.F", "F"},
+		{"github.com/a/b.Map[...]", "Map[...]"},
+		{"github.com/a/b.Handle.func1", "Handle.func1"},
+	}
+
+	for _, test := range funcs {
+		if got := funcName(test.name); got != test.expected {
+			t.Fatalf("function name error. name: %s, expected: %s, got: %s", test.name, test.expected, got)
+		}
+	}
+
+	var types = []struct {
+		t        reflect.Type
+		expected string
+	}{
+		{reflect.TypeOf(&TestController{}), "*TestController"},
+		{reflect.TypeOf(func(*Context) {}), "func(*iafon.Context)"},
+		{reflect.TypeOf(map[string]*Context{}), "map[string]*iafon.Context"},
+	}
+
+	for _, test := range types {
+		if got := typeName(test.t); got != test.expected {
+			t.Fatalf("type name error. type: %s, expected: %s, got: %s", test.t, test.expected, got)
+		}
+	}
+}
+
+func TestRouteTreeDOT(t *testing.T) {
+	var handler = func(*Context) {}
+
+	r := newRouter()
+	r.GET("/user/:id<int>", handler)
+	r.GET("/user/list", handler)
+	r.GET(`/say/"hi"`, handler)
+
+	dot := r.RouteTree().DOT()
+
+	for _, expected := range []string{
+		"digraph RouteTree {\n",
+		`[label=":id<int>", peripheries=2];`,
+		`[label="list", peripheries=2];`,
+		`[label="say/\"hi\"", peripheries=2];`,
+		"\tn0 -> n1;\n",
+	} {
+		if !strings.Contains(dot, expected) {
+			t.Fatalf("DOT should contain %q, got:\n%s", expected, dot)
+		}
+	}
+
+	if err := r.Freeze(); err != nil {
+		t.Fatal(err)
+	}
+	if r.RouteTree().DOT() != dot {
+		t.Fatal("DOT of frozen router should be the same")
+	}
+
+	if newRouter().SetMatcher(&PatternMapByList{}).RouteTree() != nil {
+		t.Fatal("RouteTree of list matcher should be nil")
+	}
+}
@@ -2,6 +2,7 @@ package iafon
 
 import (
 	"fmt"
+	"net/http"
 )
 
 type RouteGroup struct {
@@ -12,7 +13,16 @@ type RouteGroup struct {
 	subgroups []*RouteGroup
 
 	prefix      string
-	middlewares []MiddlewareInterface
+	middlewares []tGroupMiddleware
+
+	// middlewares not used by this group, see SkipMiddleware
+	skipped []MiddlewareInterface
+
+	// conditions of routes in this group, see RouteNode.When
+	conditions []RouteCondition
+
+	// metadata of routes in this group, see RouteNode.SetMeta
+	meta map[string]interface{}
 }
 
 func (g *RouteGroup) SetPrefix(prefix string) *RouteGroup {
@@ -23,6 +33,10 @@ func (g *RouteGroup) SetPrefix(prefix string) *RouteGroup {
 		panic("prefix should be set before adding sub groups")
 	}
 	if g.parent != nil && g.parent.prefix != "" {
+		// host or host pattern, like "x.org/admin" or ":tenant.x.org", should be in the top prefix
+		if prefix != "" && prefix[0] != '/' {
+			panic(fmt.Sprintf("prefix '%s' with host could not be under prefix '%s'.", prefix, g.parent.prefix))
+		}
 		if g.parent.prefix[len(g.parent.prefix)-1] == '/' && prefix[0] == '/' {
 			panic(fmt.Sprintf("prefix '%s' concat '%s' to form invalid path.", g.parent.prefix, prefix))
 		}
@@ -33,83 +47,170 @@ func (g *RouteGroup) SetPrefix(prefix string) *RouteGroup {
 	return g
 }
 
-func (g *RouteGroup) UseMiddleware(m MiddlewareInterface, execOrder ...int16) *RouteGroup {
-	if m.GetBaseMiddleware().addOrder == 0 {
-		markMiddlewareAsAdded(m, execOrder...)
+// UseMiddleware uses middleware m for routes of this group, including routes added later.
+// m is MiddlewareInterface, or middleware of net/http like func(http.Handler) http.Handler,
+// the response writer and request it passes to the next handler are used by handlers after it,
+// which get a copy of Context, so the middleware could call next by another goroutine, like http.TimeoutHandler.
+// for each request, a copy of MiddlewareInterface m is created like RegisterController,
+// it is reused by later requests after Handle or Wrap returns or panics, so do not keep it after that.
+func (g *RouteGroup) UseMiddleware(middleware interface{}, execOrder ...int16) *RouteGroup {
+	return g.useMiddleware(toMiddleware(middleware), nil, execOrder...)
+}
+
+// UseMiddlewareIf uses middleware m for routes of this group like UseMiddleware,
+// but m runs only if cond is satisfied, like UseMiddlewareIf(iafon.IfPath("/admin/**"), &AuthMiddleware{})
+func (g *RouteGroup) UseMiddlewareIf(cond MiddlewareCondition, middleware interface{}, execOrder ...int16) *RouteGroup {
+	if cond == nil {
+		panic("route: nil middleware condition")
+	}
+	return g.useMiddleware(toMiddleware(middleware), cond, execOrder...)
+}
+
+func (g *RouteGroup) useMiddleware(m MiddlewareInterface, cond MiddlewareCondition, execOrder ...int16) *RouteGroup {
+	g.router.registerMiddleware(m, execOrder...)
+
+	if skipsMiddleware(g.skipped, m) {
+		return g
+	}
+
+	for _, r := range g.routes {
+		r.useMiddleware(m, cond)
+	}
+
+	for _, subgroup := range g.subgroups {
+		subgroup.useMiddleware(m, cond)
+	}
+
+	g.middlewares = append(g.middlewares, tGroupMiddleware{m: m, cond: cond})
+
+	return g
+}
+
+// SkipMiddleware removes middlewares from routes of this group and its subgroups, including those
+// used by parent groups later, see RouteNode.SkipMiddleware
+func (g *RouteGroup) SkipMiddleware(middlewares ...MiddlewareInterface) *RouteGroup {
+	checkSkippedMiddlewares(middlewares)
+	g.skipped = append(g.skipped, middlewares...)
+
+	kept := g.middlewares[:0:0]
+	for _, gm := range g.middlewares {
+		if !skipsMiddleware(g.skipped, gm.m) {
+			kept = append(kept, gm)
+		}
+	}
+	g.middlewares = kept
+
+	for _, r := range g.routes {
+		r.SkipMiddleware(middlewares...)
+	}
+
+	for _, subgroup := range g.subgroups {
+		subgroup.SkipMiddleware(middlewares...)
+	}
+
+	return g
+}
+
+// When adds conditions to routes of this group, including routes added later, see RouteNode.When
+func (g *RouteGroup) When(conditions ...RouteCondition) *RouteGroup {
+	for _, r := range g.routes {
+		r.When(conditions...)
+	}
+
+	for _, subgroup := range g.subgroups {
+		subgroup.When(conditions...)
 	}
 
+	g.conditions = append(g.conditions, conditions...)
+
+	return g
+}
+
+// SetMeta attaches metadata to routes of this group, including routes added later, see RouteNode.SetMeta
+func (g *RouteGroup) SetMeta(key string, value interface{}) *RouteGroup {
 	for _, r := range g.routes {
-		r.UseMiddleware(m)
+		r.SetMeta(key, value)
 	}
 
 	for _, subgroup := range g.subgroups {
-		subgroup.UseMiddleware(m)
+		subgroup.SetMeta(key, value)
 	}
 
-	g.middlewares = append(g.middlewares, m)
+	g.meta = copyMeta(g.meta, key, value)
 
 	return g
 }
 
-func (g *RouteGroup) Handle(method, pattern string, handler interface{}) *RouteNode {
+// Handle adds route of method and pattern, conditions are checked for choosing it besides those of group,
+// see RouteCondition. conditions are known before checking duplicate routes, so the route could be added
+// after the route of the same pattern without conditions, like GET("/report", v2, MatchAccept("text/csv")).
+func (g *RouteGroup) Handle(method, pattern string, handler interface{}, conditions ...RouteCondition) *RouteNode {
 	pattern = g.prefix + pattern
 
-	rn := g.router.addRoute(method, pattern, handler)
+	rn := g.router.newRoute(method, pattern, handler)
+	rn.group = g
+	rn.update(func(s *tRouteState) {
+		s.conditions = append(append([]RouteCondition(nil), g.conditions...), conditions...)
+		s.meta = g.meta
+	})
 
-	for _, m := range g.middlewares {
-		rn.UseMiddleware(m)
+	// middlewares are used before the route is served
+	for _, gm := range g.middlewares {
+		rn.useMiddleware(gm.m, gm.cond)
 	}
 
-	g.routes = append(g.routes, rn)
+	g.router.addRoute(rn, pattern)
 
 	return rn
 }
 
-func (g *RouteGroup) GET(pattern string, handler interface{}) *RouteNode {
-	return g.Handle("GET", pattern, handler)
+func (g *RouteGroup) GET(pattern string, handler interface{}, conditions ...RouteCondition) *RouteNode {
+	return g.Handle("GET", pattern, handler, conditions...)
 }
 
-func (g *RouteGroup) POST(pattern string, handler interface{}) *RouteNode {
-	return g.Handle("POST", pattern, handler)
+func (g *RouteGroup) POST(pattern string, handler interface{}, conditions ...RouteCondition) *RouteNode {
+	return g.Handle("POST", pattern, handler, conditions...)
 }
 
-func (g *RouteGroup) PUT(pattern string, handler interface{}) *RouteNode {
-	return g.Handle("PUT", pattern, handler)
+func (g *RouteGroup) PUT(pattern string, handler interface{}, conditions ...RouteCondition) *RouteNode {
+	return g.Handle("PUT", pattern, handler, conditions...)
 }
 
-func (g *RouteGroup) DELETE(pattern string, handler interface{}) *RouteNode {
-	return g.Handle("DELETE", pattern, handler)
+func (g *RouteGroup) DELETE(pattern string, handler interface{}, conditions ...RouteCondition) *RouteNode {
+	return g.Handle("DELETE", pattern, handler, conditions...)
 }
 
-func (g *RouteGroup) OPTIONS(pattern string, handler interface{}) *RouteNode {
-	return g.Handle("OPTIONS", pattern, handler)
+func (g *RouteGroup) OPTIONS(pattern string, handler interface{}, conditions ...RouteCondition) *RouteNode {
+	return g.Handle("OPTIONS", pattern, handler, conditions...)
 }
 
-func (g *RouteGroup) HEAD(pattern string, handler interface{}) *RouteNode {
-	return g.Handle("HEAD", pattern, handler)
+func (g *RouteGroup) HEAD(pattern string, handler interface{}, conditions ...RouteCondition) *RouteNode {
+	return g.Handle("HEAD", pattern, handler, conditions...)
 }
 
-func (g *RouteGroup) PATCH(pattern string, handler interface{}) *RouteNode {
-	return g.Handle("PATCH", pattern, handler)
+func (g *RouteGroup) PATCH(pattern string, handler interface{}, conditions ...RouteCondition) *RouteNode {
+	return g.Handle("PATCH", pattern, handler, conditions...)
 }
 
-func (g *RouteGroup) Any(pattern string, handler interface{}) *RouteNode {
-	return g.Handle("*", pattern, handler)
+func (g *RouteGroup) Any(pattern string, handler interface{}, conditions ...RouteCondition) *RouteNode {
+	return g.Handle("*", pattern, handler, conditions...)
 }
 
-func (g *RouteGroup) Some(methods []string, pattern string, handler interface{}) *RouteGroup {
+func (g *RouteGroup) Some(methods []string, pattern string, handler interface{}, conditions ...RouteCondition) *RouteGroup {
 	return g.Group(func(group *RouteGroup) {
 		for _, method := range methods {
-			group.Handle(method, pattern, handler)
+			group.Handle(method, pattern, handler, conditions...)
 		}
 	})
 }
 
 func (g *RouteGroup) Group(p ...interface{}) *RouteGroup {
 	subgroup := &RouteGroup{router: g.router, parent: g, prefix: g.prefix}
-	for _, m := range g.middlewares {
-		subgroup.UseMiddleware(m)
+	for _, gm := range g.middlewares {
+		subgroup.useMiddleware(gm.m, gm.cond)
 	}
+	subgroup.conditions = append(subgroup.conditions, g.conditions...)
+	subgroup.meta = g.meta
 	g.subgroups = append(g.subgroups, subgroup)
 
 	for i, v := range p {
@@ -119,8 +220,10 @@ func (g *RouteGroup) Group(p ...interface{}) *RouteGroup {
 				panic("route group prefix should be the first parameter.")
 			}
 			subgroup.SetPrefix(v)
-		case MiddlewareInterface:
+		case MiddlewareInterface, func(http.Handler) http.Handler:
 			subgroup.UseMiddleware(v)
+		case RouteCondition:
+			subgroup.When(v)
 		case func(*RouteGroup):
 			if i != len(p)-1 {
 				panic("route group callback should be the last parameter.")
@@ -1,50 +1,443 @@
 package iafon
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"sort"
 	"strconv"
+	"strings"
+	"sync/atomic"
 )
 
 type RouteNode struct {
-	host     string
-	method   string
-	pattern  string
+	host    string
+	method  string
+	pattern string
+
+	group *RouteGroup
+
+	// name for generating url by Router.URL
+	name string
+
+	// middlewares not used by this route, see SkipMiddleware
+	skipped []MiddlewareInterface
+
+	// the current *tRouteState, it is replaced by a modified copy when route is changed,
+	// so requests being served keep using the state they loaded
+	state atomic.Value
+}
+
+// tRouteState is the part of route read by requests being served, it is never modified after published
+type tRouteState struct {
 	handlers []*tMixHandler
+
+	// all patterns added for this route, including expanded optional segments and aliases
+	patterns []string
+
+	// conditions of request for choosing this route, see When
+	conditions []RouteCondition
+
+	// metadata like summary, tags or permission, read by middlewares and tools, see SetMeta
+	meta map[string]interface{}
+
+	// handlers compiled by Router.Freeze
+	chain []func(*Context) bool
+}
+
+// load returns the current state of rn
+func (rn *RouteNode) load() *tRouteState {
+	if s, ok := rn.state.Load().(*tRouteState); ok {
+		return s
+	}
+	return &tRouteState{}
+}
+
+// update publishes a copy of state of rn modified by f.
+// f should not modify slices or maps of the state in place, they may be read by requests being served.
+func (rn *RouteNode) update(f func(s *tRouteState)) {
+	s := *rn.load()
+	f(&s)
+	rn.state.Store(&s)
+}
+
+// UseMiddleware uses middleware m for this route, see RouteGroup.UseMiddleware
+func (rn *RouteNode) UseMiddleware(middleware interface{}, execOrder ...int16) *RouteNode {
+	return rn.useMiddleware(toMiddleware(middleware), nil, execOrder...)
+}
+
+// useMiddleware uses m for this route, it runs only if cond is satisfied when cond is not nil
+func (rn *RouteNode) useMiddleware(m MiddlewareInterface, cond MiddlewareCondition, execOrder ...int16) *RouteNode {
+	if rn.load().chain != nil {
+		panic("route: router is frozen, middleware could not be used")
+	}
+
+	rn.group.router.registerMiddleware(m, execOrder...)
+
+	if skipsMiddleware(rn.skipped, m) {
+		return rn
+	}
+
+	h := newMixHandler(rn.group.router, m)
+	h.cond = cond
+
+	rn.update(func(s *tRouteState) {
+		// handlers are sorted by order, then by seq
+		i := len(s.handlers) - 1
+
+		for ; i >= 0; i-- {
+			if s.handlers[i].order > h.order || (s.handlers[i].order == h.order && s.handlers[i].seq <= h.seq) {
+				break
+			}
+		}
+
+		handlers := make([]*tMixHandler, 0, len(s.handlers)+1)
+		handlers = append(handlers, s.handlers[:i+1]...)
+		handlers = append(handlers, h)
+		s.handlers = append(handlers, s.handlers[i+1:]...)
+	})
+
+	return rn
+}
+
+// SkipMiddleware removes middlewares from this route, including those used by its groups later,
+// like skipping the auth middleware of group for the login route.
+// middleware is the value used, net/http middleware is skipped by the value of HTTPMiddleware used.
+func (rn *RouteNode) SkipMiddleware(middlewares ...MiddlewareInterface) *RouteNode {
+	if rn.load().chain != nil {
+		panic("route: router is frozen, middleware could not be skipped")
+	}
+
+	checkSkippedMiddlewares(middlewares)
+	rn.skipped = append(rn.skipped, middlewares...)
+
+	rn.update(func(s *tRouteState) {
+		handlers := make([]*tMixHandler, 0, len(s.handlers))
+		for _, h := range s.handlers {
+			if h.hType != cHTYPE_MIDDLEWARE || !skipsMiddleware(rn.skipped, h.middleware) {
+				handlers = append(handlers, h)
+			}
+		}
+		s.handlers = handlers
+	})
+
+	return rn
+}
+
+// SetMeta attaches metadata to this route, like SetMeta("perm", "user.edit"),
+// it is read by c.Route().Meta("perm") in middlewares and handlers.
+func (rn *RouteNode) SetMeta(key string, value interface{}) *RouteNode {
+	if rn.load().chain != nil {
+		panic("route: router is frozen, meta could not be set")
+	}
+
+	rn.update(func(s *tRouteState) {
+		s.meta = copyMeta(s.meta, key, value)
+	})
+
+	return rn
+}
+
+// Meta returns metadata of key, nil if not set
+func (rn *RouteNode) Meta(key string) interface{} {
+	return rn.load().meta[key]
+}
+
+// MetaMap returns a copy of all metadata of this route
+func (rn *RouteNode) MetaMap() map[string]interface{} {
+	return copyMeta(rn.load().meta, "", nil)
+}
+
+// copyMeta returns a copy of meta with key set to value, key is not set if it is empty
+func copyMeta(meta map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(meta)+1)
+	for k, v := range meta {
+		c[k] = v
+	}
+	if key != "" {
+		c[key] = value
+	}
+	return c
 }
 
-func (rn *RouteNode) UseMiddleware(m MiddlewareInterface, execOrder ...int16) *RouteNode {
-	if m.GetBaseMiddleware().addOrder == 0 {
-		markMiddlewareAsAdded(m, execOrder...)
+func (rn *RouteNode) Method() string {
+	return rn.method
+}
+
+func (rn *RouteNode) Host() string {
+	return rn.host
+}
+
+// Pattern returns the pattern of this route without host, group prefix is included
+func (rn *RouteNode) Pattern() string {
+	return hideMountParam(rn.pattern)
+}
+
+// compileChain compiles handlers, so the type of handler is not checked for each request
+func (rn *RouteNode) compileChain() {
+	handlers := rn.load().handlers
+	chain := make([]func(*Context) bool, len(handlers))
+	for i, h := range handlers {
+		if h.wrapper {
+			h, i := h, i
+			// handlers after the wrapper are called by its next
+			chain[i] = func(ctx *Context) bool {
+				h.wrap(ctx, func(c *Context) {
+					serveChain(c, chain, i+1)
+				})
+				return false
+			}
+		} else {
+			chain[i] = h.compile()
+		}
+
+		if cond := h.cond; cond != nil {
+			call := chain[i]
+			chain[i] = func(ctx *Context) bool {
+				if !cond(ctx) {
+					return true
+				}
+				return call(ctx)
+			}
+		}
 	}
+	rn.update(func(s *tRouteState) {
+		s.chain = chain
+	})
+}
 
-	h := newMixHandler(m)
+// serve calls handlers of route until a middleware returns false
+func (rn *RouteNode) serve(ctx *Context) {
+	// request keeps using the state it starts with, even if middleware is used or skipped meanwhile
+	s := rn.load()
+	if s.chain != nil {
+		serveChain(ctx, s.chain, 0)
+		return
+	}
 
-	i := len(rn.handlers) - 1
+	rn.serveHandlers(ctx, s.handlers, 0)
+}
 
-	for ; i >= 0; i-- {
-		if rn.handlers[i].order > h.order {
+// serveChain calls compiled handlers from the ith until a middleware returns false
+func serveChain(ctx *Context, chain []func(*Context) bool, i int) {
+	for ; i < len(chain); i++ {
+		if next := chain[i](ctx); !next {
 			break
 		}
 	}
+}
 
-	rn.handlers = append(rn.handlers, nil)
-	copy(rn.handlers[i+2:], rn.handlers[i+1:])
-	rn.handlers[i+1] = h
+// serveHandlers calls handlers from the ith until a middleware returns false
+func (rn *RouteNode) serveHandlers(ctx *Context, handlers []*tMixHandler, i int) {
+	for ; i < len(handlers); i++ {
+		h := handlers[i]
+		if h.cond != nil && !h.cond(ctx) {
+			continue
+		}
+		if h.wrapper {
+			h.wrap(ctx, func(c *Context) {
+				rn.serveHandlers(c, handlers, i+1)
+			})
+			break
+		}
+		if next := h.call(ctx); !next {
+			break
+		}
+	}
+}
+
+// Alias adds another pattern for this route, group prefix is applied to pattern.
+// the route and its middlewares are shared by all its patterns.
+func (rn *RouteNode) Alias(pattern string) *RouteNode {
+	if rn.group == nil {
+		panic("route: alias should be added to route created by route group")
+	}
+
+	rn.group.router.updateRoutes(func(t *tRouteTable) {
+		t.addPattern(rn, rn.group.prefix+pattern)
+	})
 
 	return rn
 }
 
-func newRouteNode(host, method, pattern string, mainHandler interface{}) *RouteNode {
-	rn := &RouteNode{
-		host:     host,
-		method:   method,
-		pattern:  pattern,
-		handlers: []*tMixHandler{newMixHandler(mainHandler)},
+// Remove removes this route with all its patterns and its name.
+// requests being served by the route are not affected.
+func (rn *RouteNode) Remove() {
+	if rn.group == nil {
+		panic("route: route not created by route group could not be removed")
+	}
+
+	rn.group.router.removeRoute(rn)
+}
+
+// Name names this route, so its url could be generated by Router.URL
+func (rn *RouteNode) Name(name string) *RouteNode {
+	if rn.group == nil {
+		panic("route: name should be set to route created by route group")
+	}
+	if name == "" {
+		panic("route: route name should not be empty")
+	}
+	if rn.name != "" {
+		panic(fmt.Sprintf("route: route is named '%s' already", rn.name))
+	}
+
+	rn.group.router.updateRoutes(func(t *tRouteTable) {
+		if t.names[name] != nil {
+			panic(fmt.Sprintf("route: duplicate route name '%s'", name))
+		}
+
+		// names of published table are never modified, modify a copy
+		names := make(map[string]*RouteNode, len(t.names)+1)
+		for k, v := range t.names {
+			names[k] = v
+		}
+		names[name] = rn
+		t.names = names
+
+		rn.name = name
+	})
+
+	return rn
+}
+
+// url generates url of this route.
+// the pattern using most of params is chosen, unused params are added as query string.
+func (rn *RouteNode) url(params map[string]string) (string, error) {
+	var best_url string
+	var best_used = -1
+	var err error
+
+	patterns := rn.load().patterns
+	for _, pattern := range patterns {
+		host, path := splitHostPattern(pattern)
+
+		p, used, e := fillPattern(path, params)
+		if e != nil {
+			err = e
+			continue
+		}
+
+		// host with wildcard could not be generated, url is relative to the current host
+		if host != "" && strings.IndexByte(host, '*') < 0 {
+			h, host_used, e := fillPattern(host, params)
+			if e != nil {
+				err = e
+				continue
+			}
+			p = "//" + h + p
+			used += host_used
+		}
+
+		if used > best_used {
+			best_used = used
+			best_url = p
+		}
+	}
+
+	if best_used < 0 {
+		return "", err
 	}
-	if rn.handlers[0].hType == cHTYPE_MIDDLEWARE {
+
+	if best_used < len(params) {
+		query := url.Values{}
+		for name, value := range params {
+			query.Set(name, value)
+		}
+		for _, name := range patternParams(patterns...) {
+			query.Del(name)
+		}
+		if len(query) > 0 {
+			best_url += "?" + query.Encode()
+		}
+	}
+
+	return best_url, nil
+}
+
+// fillPattern replaces params in pattern with values, used is the count of params used
+func fillPattern(pattern string, params map[string]string) (path string, used int, err error) {
+	var b strings.Builder
+
+	for pos := 0; pos < len(pattern); {
+		pos_param := pos + strings.IndexAny(pattern[pos:], ":*")
+		if pos_param < pos {
+			b.WriteString(pattern[pos:])
+			break
+		}
+
+		b.WriteString(pattern[pos:pos_param])
+
+		if pattern[pos_param] == '*' {
+			name := pattern[pos_param+1:]
+			value, ok := params[name]
+			if !ok {
+				return "", 0, errors.New("param '" + name + "' is required by pattern " + pattern)
+			}
+			// keep slashes in catch-all param
+			segments := strings.Split(value, "/")
+			for i, segment := range segments {
+				segments[i] = url.PathEscape(segment)
+			}
+			b.WriteString(strings.Join(segments, "/"))
+			used++
+			break
+		}
+
+		name, constraint, re, end := parseParam(pattern, pos_param)
+		value, ok := params[name]
+		if !ok || value == "" {
+			return "", 0, errors.New("param '" + name + "' is required by pattern " + pattern)
+		}
+		if re != nil && !re.MatchString(value) {
+			return "", 0, errors.New("param '" + name + "' does not satisfy constraint <" + constraint + ">, value: " + value)
+		}
+		b.WriteString(url.PathEscape(value))
+		used++
+
+		pos = end
+	}
+
+	return b.String(), used, nil
+}
+
+// patternParams returns names of params in patterns
+func patternParams(patterns ...string) []string {
+	var names []string
+	for _, pattern := range patterns {
+		host, pattern := splitHostPattern(pattern)
+		if host != "" {
+			names = append(names, newHostPattern(host).params()...)
+		}
+		for pos := 0; pos < len(pattern); {
+			pos_param := pos + strings.IndexAny(pattern[pos:], ":*")
+			if pos_param < pos {
+				break
+			}
+			if pattern[pos_param] == '*' {
+				names = append(names, pattern[pos_param+1:])
+				break
+			}
+			name, _, _, end := parseParam(pattern, pos_param)
+			names = append(names, name)
+			pos = end
+		}
+	}
+	return names
+}
+
+func newRouteNode(r *Router, host, method, pattern string, mainHandler interface{}) *RouteNode {
+	h := newMixHandler(r, mainHandler)
+	if h.hType == cHTYPE_MIDDLEWARE {
 		panic("middleware can not be used as route main handler.")
 	}
+
+	rn := &RouteNode{
+		host:    host,
+		method:  method,
+		pattern: pattern,
+	}
+	rn.state.Store(&tRouteState{handlers: []*tMixHandler{h}})
 	return rn
 }
 
@@ -79,8 +472,9 @@ func (s RouteNodeSlice) Less(i, j int) bool {
 	}
 }
 
+// Sort sorts routes by host, pattern and method, routes of the same ones keep their order
 func (s RouteNodeSlice) Sort() RouteNodeSlice {
-	sort.Sort(s)
+	sort.Stable(s)
 	return s
 }
 
@@ -99,7 +493,7 @@ func (s RouteNodeSlice) String() string {
 	}
 
 	for _, rn := range s {
-		str += fmt.Sprintf("%-"+strconv.Itoa(max_method_len)+"s %-"+strconv.Itoa(max_host_len)+"s %s\n", rn.method, rn.host, rn.pattern)
+		str += fmt.Sprintf("%-"+strconv.Itoa(max_method_len)+"s %-"+strconv.Itoa(max_host_len)+"s %s\n", rn.method, rn.host, rn.Pattern())
 	}
 
 	return str
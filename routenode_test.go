@@ -33,3 +33,199 @@ func TestUseMiddlewareOnRouteNode(t *testing.T) {
 		t.Fatal("RouteNode Middleware is not fired on request")
 	}
 }
+
+func TestUseMiddlewareWhileServing(t *testing.T) {
+	calls := 0
+
+	r := newRouter()
+	var rn *RouteNode
+	rn = r.GET("/counter", func(*Context) {
+		calls++
+		if calls == 1 {
+			// the request being served keeps using the handlers it starts with
+			rn.UseMiddleware(&TestRouteNodeMiddleware{}, 100)
+		}
+	}).UseMiddleware(&TestMiddleware{})
+
+	req, _ := http.NewRequest("GET", "http://localhost/counter", nil)
+	r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+	if calls != 1 {
+		t.Fatal("main handler should be called once, got:", calls)
+	}
+
+	routenode_test_echo = ""
+	r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+	if calls != 2 || routenode_test_echo != "/counter" {
+		t.Fatal("middleware used while serving should be called by the next request")
+	}
+}
+
+func TestNamedRouteURL(t *testing.T) {
+	var handler = func(*Context) {}
+
+	r := newRouter()
+	r.GET("/", handler).Name("home")
+	r.GET(`/user/:id<\d+>`, handler).Name("user.show")
+	r.GET("/report(/:format)?", handler).Name("report")
+	r.GET("/static/*filepath", handler).Name("static")
+	r.GET("/files/:name.:ext", handler).Name("file")
+
+	g := r.Group("/admin")
+	g.GET("/user/:id", handler).Name("admin.user")
+
+	h := r.Group("x.org/admin")
+	h.GET("/user/:id", handler).Name("host.user")
+
+	var urls = map[string][]string{
+		"/":                         {"home"},
+		"/user/42":                  {"user.show", "id", "42"},
+		"/user/42?tab=profile":      {"user.show", "id", "42", "tab", "profile"},
+		"/report":                   {"report"},
+		"/report/csv":               {"report", "format", "csv"},
+		"/static/css/a%20b.css":     {"static", "filepath", "css/a b.css"},
+		"/files/app.min.js":         {"file", "name", "app.min", "ext", "js"},
+		"/admin/user/a%2Fb":         {"admin.user", "id", "a/b"},
+		"//x.org/admin/user/7":      {"host.user", "id", "7"},
+		"/static/?download=1&v=abc": {"static", "filepath", "", "v", "abc", "download", "1"},
+	}
+
+	for expected, args := range urls {
+		if url := r.URL(args[0], args[1:]...); url != expected {
+			t.Fatalf("URL(%v) error, expected %s, got %s", args, expected, url)
+		}
+	}
+
+	var invalid = [][]string{
+		{"not.found"},
+		{"user.show"},
+		{"user.show", "id"},
+		{"user.show", "id", "bob"},
+	}
+
+	for _, args := range invalid {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("URL(%v) should panic", args)
+				}
+			}()
+			r.URL(args[0], args[1:]...)
+		}()
+	}
+}
+
+func TestDuplicateRouteName(t *testing.T) {
+	defer func() {
+		if p := recover(); p != "route: duplicate route name 'user'" {
+			t.Fatalf("duplicate route name should panic, got: %v", p)
+		}
+	}()
+
+	r := newRouter()
+	r.GET("/user", func(*Context) {}).Name("user")
+	r.POST("/user", func(*Context) {}).Name("user")
+}
+
+var routenode_test_perm interface{}
+
+type TestRouteMetaMiddleware struct {
+	Middleware
+}
+
+func (t *TestRouteMetaMiddleware) Handle() bool {
+	routenode_test_perm = t.Route().Meta("perm")
+	return true
+}
+
+func TestRouteMeta(t *testing.T) {
+	var summary interface{}
+
+	r := newRouter()
+	r.UseMiddleware(&TestRouteMetaMiddleware{})
+
+	admin := r.Group("/admin").SetMeta("perm", "admin").SetMeta("tags", []string{"admin"})
+	admin.GET("/user/:id", func(c *Context) {
+		summary = c.Route().Meta("summary")
+	}).SetMeta("summary", "show user")
+	admin.DELETE("/user/:id", func(c *Context) {}).SetMeta("perm", "admin.delete")
+
+	sub := admin.Group("/report")
+	sub.GET("/daily", func(c *Context) {})
+	admin.SetMeta("rate", "low")
+
+	var tests = []struct {
+		method, path string
+		perm         string
+	}{
+		{"GET", "/admin/user/42", "admin"},
+		{"DELETE", "/admin/user/42", "admin.delete"},
+		{"GET", "/admin/report/daily", "admin"},
+	}
+
+	for _, test := range tests {
+		routenode_test_perm = nil
+		req, _ := http.NewRequest(test.method, "http://localhost"+test.path, nil)
+		r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+		if routenode_test_perm != test.perm {
+			t.Fatalf("route meta error. req: %s %s, expected perm: %s, got: %v", test.method, test.path, test.perm, routenode_test_perm)
+		}
+	}
+
+	if summary != "show user" {
+		t.Fatal("route meta error. summary:", summary)
+	}
+
+	for _, rn := range r.GetRoutes() {
+		meta := rn.MetaMap()
+		if meta["rate"] != "low" || len(meta["tags"].([]string)) != 1 {
+			t.Fatalf("group meta should be inherited by routes added before and after, route: %s %s, meta: %v", rn.Method(), rn.Pattern(), meta)
+		}
+	}
+
+	if err := r.Freeze(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("setting meta after freezing should panic")
+		}
+	}()
+	r.GetRoutes()[0].SetMeta("perm", "none")
+}
+
+func TestChangeRouteWhileServingConcurrently(t *testing.T) {
+	r := newRouter()
+	rn := r.GET("/concurrent", func(c *Context) {
+		_ = c.Route().Meta("perm")
+	})
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		req, _ := http.NewRequest("GET", "http://localhost/concurrent", nil)
+		r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+		close(started)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+			}
+		}
+	}()
+
+	<-started
+	for i := 0; i < 100; i++ {
+		rn.UseMiddleware(func(h http.Handler) http.Handler { return h })
+		rn.SetMeta("perm", i)
+	}
+	close(done)
+	<-served
+
+	if rn.Meta("perm") != 99 {
+		t.Fatal("meta should be the last value set, got:", rn.Meta("perm"))
+	}
+}
@@ -1,12 +1,16 @@
 package iafon
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"path"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 var http_methods = map[string]bool{
@@ -22,26 +26,236 @@ var http_methods = map[string]bool{
 	"TRACE":   true,
 }
 
-type tMap_Method_RouteNode map[string]*RouteNode
+// routes of each method, routes of the same method have different conditions, in the order of trying
+type tMap_Method_RouteNode map[string][]*RouteNode
 
 type tMap_Host_Method_RouteNode struct {
 	hosts           map[string]tMap_Method_RouteNode
 	shouldMatchHost bool
+
+	// hosts like ":tenant.example.com" and "*.example.com", in the order of matching
+	hostPatterns []*tHostPattern
+}
+
+// tRouteTable is a snapshot of routes, it is never modified after published by Router
+type tRouteTable struct {
+	matcher PatternMapInterface
+
+	// routes named by RouteNode.Name
+	names map[string]*RouteNode
 }
 
 type Router struct {
 	RouteGroup
-	matcher       *PatternMapByTree
 	errorHandlers map[int]Handler
+
+	// the current *tRouteTable, routes are added and removed by publishing a modified copy,
+	// so requests being served keep using the snapshot they loaded
+	table atomic.Value
+	// serializes modifications of routes
+	mu sync.Mutex
+
+	// 1 if routes are frozen by Freeze, routes could not be added or removed since then
+	frozen int32
+	// call Freeze in Server.Run, disabled by default, see SetFreezeOnRun
+	freezeOnRun bool
+
+	contextPool sync.Pool
+
+	// serve HEAD request by GET route if HEAD route is not added, enabled by default
+	autoHEAD bool
+	// answer OPTIONS request with allowed methods if OPTIONS route is not added, enabled by default
+	autoOPTIONS bool
+	// send allowed methods in Allow header of 405 response, enabled by default
+	allowHeader bool
+
+	// how to handle path which does not match route pattern exactly, redirect by default
+	pathPolicy PathPolicy
+
+	// methods registered by RegisterMethod besides http_methods, like "PROPFIND" or "PURGE"
+	methods map[string]bool
+
+	// routers mounted by RouteGroup.Mount, frozen with this router
+	mountedRouters []*Router
+	// this router is mounted by another router, params of mount prefix are passed by request context
+	mounted bool
+
+	// controllers and middlewares used by routes
+	registry tRegistry
 }
 
 func newRouter() *Router {
 	r := &Router{}
 	r.RouteGroup.router = r
-	r.matcher = &PatternMapByTree{}
+	r.table.Store(&tRouteTable{matcher: &PatternMapByTree{}})
+	r.contextPool.New = func() interface{} {
+		return &Context{}
+	}
+	r.autoHEAD = true
+	r.autoOPTIONS = true
+	r.allowHeader = true
 	return r
 }
 
+// Freeze validates routes by Validate, it fails if any error is found.
+// it compiles the matcher and handler chains of routes to serve faster, routers mounted are frozen too.
+// routes and their middlewares could not be changed after freezing.
+// it is called by Server.Run if SetFreezeOnRun(true) is called, routes could be changed while running otherwise.
+func (r *Router) Freeze() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isFrozen() {
+		return nil
+	}
+
+	routes := r.GetRoutes()
+
+	var problems []string
+	for _, issue := range r.validate(routes).Issues {
+		if issue.Kind.IsError() {
+			problems = append(problems, issue.Message)
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("route: invalid routes, " + strings.Join(problems, "; "))
+	}
+
+	t := *r.routeTable()
+	if m, ok := t.matcher.(interface{ Compile() PatternMapInterface }); ok {
+		t.matcher = m.Compile()
+	}
+
+	for _, sub := range r.mountedRouters {
+		if err := sub.Freeze(); err != nil {
+			return err
+		}
+	}
+
+	for _, rn := range routes {
+		rn.compileChain()
+	}
+
+	atomic.StoreInt32(&r.frozen, 1)
+	r.table.Store(&t)
+
+	return nil
+}
+
+func (r *Router) isFrozen() bool {
+	return atomic.LoadInt32(&r.frozen) == 1
+}
+
+// SetFreezeOnRun sets whether Server.Run calls Freeze, it is disabled by default, so routes could be changed while running
+func (r *Router) SetFreezeOnRun(enabled bool) *Router {
+	r.freezeOnRun = enabled
+	return r
+}
+
+// RegisterMethod registers methods besides the standard ones, so routes of them could be added,
+// like RegisterMethod("PROPFIND", "MKCOL", "LOCK") for WebDAV. method is converted to upper case.
+func (r *Router) RegisterMethod(methods ...string) *Router {
+	for _, method := range methods {
+		if !isMethodToken(method) {
+			panic("http: invalid method token '" + method + "'")
+		}
+
+		if r.methods == nil {
+			r.methods = make(map[string]bool)
+		}
+		r.methods[strings.ToUpper(method)] = true
+	}
+	return r
+}
+
+// isMethodToken reports whether method is a token of RFC 7230
+func isMethodToken(method string) bool {
+	if method == "" {
+		return false
+	}
+	for i := 0; i < len(method); i++ {
+		c := method[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			continue
+		}
+		if strings.IndexByte("!#$%&'*+-.^_`|~", c) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SetAutoHEAD sets whether HEAD request is served by GET route when HEAD route is not added.
+// response body written by GET route is discarded.
+func (r *Router) SetAutoHEAD(enabled bool) *Router {
+	r.autoHEAD = enabled
+	return r
+}
+
+// SetAutoOPTIONS sets whether OPTIONS request is answered with Allow header when OPTIONS route is not added
+func (r *Router) SetAutoOPTIONS(enabled bool) *Router {
+	r.autoOPTIONS = enabled
+	return r
+}
+
+// SetPathPolicy sets how to handle path which does not match route pattern exactly,
+// like "/user" for "/user/", "/user//42" or "/user/./42"
+func (r *Router) SetPathPolicy(policy PathPolicy) *Router {
+	r.pathPolicy = policy
+	return r
+}
+
+// SetAllowHeader sets whether 405 response has Allow header of allowed methods
+func (r *Router) SetAllowHeader(enabled bool) *Router {
+	r.allowHeader = enabled
+	return r
+}
+
+// SetMatcher replaces the default PatternMapByTree matcher, it should be called before adding routes
+func (r *Router) SetMatcher(matcher PatternMapInterface) *Router {
+	if matcher == nil {
+		panic("route: matcher should not be nil")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isFrozen() {
+		panic("route: router is frozen, matcher could not be set")
+	}
+	if r.routeTable().matcher.Len() > 0 || matcher.Len() > 0 {
+		panic("route: matcher should be set before adding routes")
+	}
+	r.table.Store(&tRouteTable{matcher: matcher})
+	return r
+}
+
+// routeTable returns the current snapshot of routes
+func (r *Router) routeTable() *tRouteTable {
+	return r.table.Load().(*tRouteTable)
+}
+
+// updateRoutes calls update with a copy of the current routes, then publishes the copy.
+// if update panics, the copy is dropped and routes are not changed.
+// matcher not implementing PatternMapCloneInterface is not copied but modified in place.
+func (r *Router) updateRoutes(update func(t *tRouteTable)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isFrozen() {
+		panic("route: router is frozen, routes could not be changed")
+	}
+
+	old := r.routeTable()
+	t := &tRouteTable{matcher: old.matcher, names: old.names}
+	if m, ok := old.matcher.(PatternMapCloneInterface); ok {
+		t.matcher = m.Clone()
+	}
+
+	update(t)
+
+	r.table.Store(t)
+}
+
 func (r *Router) HandleError(code int, handler interface{}) {
 	if code != 404 && code != 405 && code != 500 {
 		panic("HandleError only support 404 405 500 http code")
@@ -61,11 +275,39 @@ func (r *Router) HandleError(code int, handler interface{}) {
 	}
 }
 
-func (r *Router) addRoute(method, pattern string, handler interface{}) *RouteNode {
+// URL generates url of the route named by RouteNode.Name.
+// params are pairs of param name and value, like URL("user.show", "id", "42").
+// params not used by route pattern are added as query string.
+// if route pattern has host, url is scheme relative, like "//x.org/admin/user/42".
+func (r *Router) URL(name string, params ...string) string {
+	rn := r.routeTable().names[name]
+	if rn == nil {
+		panic(fmt.Sprintf("route: route named '%s' not found", name))
+	}
+
+	if len(params)%2 != 0 {
+		panic("route: params of URL should be pairs of param name and value")
+	}
+
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	url, err := rn.url(values)
+	if err != nil {
+		panic(fmt.Sprintf("route: fail to generate url of route '%s', %s", name, err))
+	}
+
+	return url
+}
+
+// newRoute creates the route of method and pattern, the route is not added until addRoute is called
+func (r *Router) newRoute(method, pattern string, handler interface{}) *RouteNode {
 	method = strings.ToUpper(method)
 
-	if !http_methods[method] {
-		panic("http: invalid method " + method)
+	if !http_methods[method] && !r.methods[method] {
+		panic("http: invalid method " + method + ", custom method should be registered by RegisterMethod")
 	}
 	if len(pattern) == 0 {
 		panic("http: route pattern can not be empty")
@@ -74,51 +316,283 @@ func (r *Router) addRoute(method, pattern string, handler interface{}) *RouteNod
 		panic("http: nil handler")
 	}
 
-	raw_pattern := pattern
-	host := ""
+	host, path := splitHostPattern(pattern)
+
+	return newRouteNode(r, host, method, path, handler)
+}
+
+// addRoute adds rn with pattern, the route is served since then
+func (r *Router) addRoute(rn *RouteNode, pattern string) {
+	r.updateRoutes(func(t *tRouteTable) {
+		t.addPattern(rn, pattern)
 
-	if pattern[0] != '/' {
-		if pos := strings.IndexByte(pattern, '/'); pos > 0 {
-			host = pattern[:pos]
-			pattern = pattern[pos:]
+		if rn.group != nil {
+			rn.group.routes = append(rn.group.routes, rn)
+		}
+	})
+}
+
+// addPattern adds pattern for rn, optional segments in pattern will be expanded.
+// all patterns added for rn share rn and its middlewares.
+func (t *tRouteTable) addPattern(rn *RouteNode, raw_pattern string) {
+	host, pattern := splitHostPattern(raw_pattern)
+
+	for _, pattern := range expandPattern(pattern) {
+		var m *tMap_Host_Method_RouteNode
+
+		// values in published table are never modified, modify a copy
+		if v := t.matcher.Get(pattern); v != nil {
+			m = v.(*tMap_Host_Method_RouteNode).clone()
+		}
+
+		if m == nil {
+			m = &tMap_Host_Method_RouteNode{}
+			m.hosts = make(map[string]tMap_Method_RouteNode)
+		}
+
+		if host != "" {
+			m.shouldMatchHost = true
+		}
+
+		if isHostPattern(host) {
+			m.addHostPattern(host, pattern, rn)
 		} else {
-			panic(fmt.Sprintf("http: invalid pattern, you need /%s or %[1]s/, meaning /path, host/path", pattern))
+			if m.hosts[host] == nil {
+				m.hosts[host] = make(tMap_Method_RouteNode)
+			}
+
+			m.hosts[host].add(rn, host+pattern)
+		}
+
+		t.matcher.Set(pattern, m)
+
+		rn.update(func(s *tRouteState) {
+			s.patterns = append(s.patterns[:len(s.patterns):len(s.patterns)], host+pattern)
+		})
+	}
+}
+
+// Remove removes the route of method and pattern, group prefix should be included in pattern.
+// if several routes of method and pattern are added with conditions, the first one tried is removed.
+// it reports whether the route is found, see RouteNode.Remove.
+func (r *Router) Remove(method, pattern string) bool {
+	host, path := splitHostPattern(pattern)
+
+	v := r.routeTable().matcher.Get(expandPattern(path)[0])
+	if v == nil {
+		return false
+	}
+
+	m := v.(*tMap_Host_Method_RouteNode)
+	method = strings.ToUpper(method)
+
+	var candidates []*RouteNode
+	if isHostPattern(host) {
+		for _, hp := range m.hostPatterns {
+			if hp.pattern == host {
+				candidates = hp.methods[method]
+			}
+		}
+	} else {
+		candidates = m.hosts[host][method]
+	}
+
+	if len(candidates) == 0 {
+		return false
+	}
+
+	r.removeRoute(candidates[0])
+	return true
+}
+
+// removeRoute removes all patterns of rn, its name, and removes rn from its group
+func (r *Router) removeRoute(rn *RouteNode) {
+	if _, ok := r.routeTable().matcher.(PatternMapCloneInterface); !ok {
+		panic("route: matcher does not implement PatternMapCloneInterface, routes could not be removed")
+	}
+
+	r.updateRoutes(func(t *tRouteTable) {
+		for _, raw_pattern := range rn.load().patterns {
+			host, pattern := splitHostPattern(raw_pattern)
+
+			v := t.matcher.Get(pattern)
+			if v == nil {
+				continue
+			}
+
+			// values in published table are never modified, modify a copy
+			m := v.(*tMap_Host_Method_RouteNode).clone()
+			m.remove(host, rn)
+
+			if len(m.hosts) == 0 && len(m.hostPatterns) == 0 {
+				t.matcher.(PatternMapCloneInterface).Delete(pattern)
+			} else {
+				t.matcher.Set(pattern, m)
+			}
+		}
+
+		if rn.name != "" && t.names[rn.name] == rn {
+			names := make(map[string]*RouteNode, len(t.names))
+			for k, v := range t.names {
+				if k != rn.name {
+					names[k] = v
+				}
+			}
+			t.names = names
+		}
+
+		if g := rn.group; g != nil {
+			for i, route := range g.routes {
+				if route == rn {
+					g.routes = append(g.routes[:i:i], g.routes[i+1:]...)
+					break
+				}
+			}
 		}
+	})
+}
+
+// clone returns a copy of m, which could be modified without affecting m
+func (m *tMap_Host_Method_RouteNode) clone() *tMap_Host_Method_RouteNode {
+	c := &tMap_Host_Method_RouteNode{
+		hosts:           make(map[string]tMap_Method_RouteNode, len(m.hosts)),
+		shouldMatchHost: m.shouldMatchHost,
 	}
 
-	var m *tMap_Host_Method_RouteNode
+	for host, methods := range m.hosts {
+		c.hosts[host] = methods.clone()
+	}
 
-	if v := r.matcher.Get(pattern); v != nil {
-		m = v.(*tMap_Host_Method_RouteNode)
+	for _, hp := range m.hostPatterns {
+		cp := *hp
+		cp.methods = hp.methods.clone()
+		c.hostPatterns = append(c.hostPatterns, &cp)
 	}
 
-	if m == nil {
-		m = &tMap_Host_Method_RouteNode{}
-		m.hosts = make(map[string]tMap_Method_RouteNode)
-	} else if m.hosts[host] != nil && m.hosts[host][method] != nil {
-		panic(fmt.Sprintf("http: duplicate route '%s %s'", method, raw_pattern))
+	return c
+}
+
+func (m tMap_Method_RouteNode) clone() tMap_Method_RouteNode {
+	c := make(tMap_Method_RouteNode, len(m))
+	for method, rn := range m {
+		c[method] = rn
 	}
+	return c
+}
 
-	if m.hosts[host] == nil {
-		m.hosts[host] = make(tMap_Method_RouteNode)
+// remove removes rn of host from m
+func (m *tMap_Host_Method_RouteNode) remove(host string, rn *RouteNode) {
+	if isHostPattern(host) {
+		for i, hp := range m.hostPatterns {
+			if hp.pattern == host && hp.methods.remove(rn) {
+				if len(hp.methods) == 0 {
+					m.hostPatterns = append(m.hostPatterns[:i], m.hostPatterns[i+1:]...)
+				}
+				break
+			}
+		}
+	} else if m.hosts[host].remove(rn) {
+		if len(m.hosts[host]) == 0 {
+			delete(m.hosts, host)
+		}
 	}
 
-	if host != "" {
-		m.shouldMatchHost = true
+	m.shouldMatchHost = len(m.hostPatterns) > 0
+	for host := range m.hosts {
+		if host != "" {
+			m.shouldMatchHost = true
+		}
 	}
+}
 
-	rn := newRouteNode(host, method, pattern, handler)
+// splitHostPattern splits "host/path" to "host" and "/path", host could be a pattern like ":tenant.example.com"
+func splitHostPattern(pattern string) (host, path string) {
+	if len(pattern) == 0 {
+		panic("http: route pattern can not be empty")
+	}
 
-	m.hosts[host][method] = rn
+	if pattern[0] == '/' {
+		return "", pattern
+	}
 
-	r.matcher.Set(pattern, m)
+	pos := 0
+	for ; pos < len(pattern) && pattern[pos] != '/'; pos++ {
+		// skip param constraint of host pattern, which may contain '/'
+		if pattern[pos] == '<' {
+			if end := constraintEnd(pattern, pos); end > 0 {
+				pos = end
+			}
+		}
+	}
+	if pos == len(pattern) {
+		panic(fmt.Sprintf("http: invalid pattern, you need /%s or %[1]s/, meaning /path, host/path", pattern))
+	}
+
+	return pattern[:pos], pattern[pos:]
+}
+
+// expandPattern expands optional segments in pattern,
+// "/report(/:format)?" expands to "/report/:format" and "/report".
+// optional segments could be nested, "/a(/b(/c)?)?" expands to "/a/b/c", "/a/b" and "/a".
+func expandPattern(pattern string) []string {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '<':
+			// skip param constraint, which may contain '(' and ')'
+			if end := constraintEnd(pattern, i); end > 0 {
+				i = end
+			}
+		case ')':
+			panic("route: unexpected ) in pattern " + pattern)
+		case '(':
+			end := optionalEnd(pattern, i)
+			if end < 0 || end+1 >= len(pattern) || pattern[end+1] != '?' {
+				panic("route: optional segment should be closed by )?, pattern: " + pattern)
+			}
+			if i+1 == end {
+				panic("route: optional segment should not be empty, pattern: " + pattern)
+			}
 
-	return rn
+			var patterns []string
+			for _, rest := range expandPattern(pattern[end+2:]) {
+				for _, optional := range expandPattern(pattern[i+1 : end]) {
+					patterns = append(patterns, pattern[:i]+optional+rest)
+				}
+				patterns = append(patterns, pattern[:i]+rest)
+			}
+			return patterns
+		}
+	}
+	return []string{pattern}
+}
+
+// optionalEnd returns position of ')' which closes the optional segment starting with '(' at pos
+func optionalEnd(pattern string, pos int) int {
+	depth := 0
+	for i := pos; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '<':
+			if end := constraintEnd(pattern, i); end > 0 {
+				i = end
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
 }
 
 // implement http.Handler interface
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	ctx := &Context{Rsp: w, Req: req}
+	ctx := r.contextPool.Get().(*Context)
+	ctx.reset(w, req, r)
+
+	defer r.contextPool.Put(ctx)
 
 	defer func() {
 		if p := recover(); p != nil {
@@ -146,29 +620,163 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		path = cleanPath(req.URL.Path)
 	}
 
-	v, params, redirect, _ := r.matcher.Match(path)
+	if r.mounted {
+		if ps, ok := req.Context().Value(tMountParamsKey{}).(Params); ok {
+			ctx.Params = append(ctx.Params, ps...)
+		}
+	}
+
+	res := r.resolve(r.routeTable(), req, req.Method, host, req.URL.Path, path, &ctx.Params)
+
+	if res.head {
+		ctx.Rsp = headResponseWriter{w}
+	}
+
+	ctx.setParams()
+
+	switch {
+	case res.rn != nil:
+		ctx.route = res.rn
+		res.rn.serve(ctx)
+	case res.status == http.StatusNoContent:
+		w.Header().Set("Allow", res.allow)
+		w.WriteHeader(http.StatusNoContent)
+	case res.status == http.StatusMethodNotAllowed:
+		if r.allowHeader {
+			w.Header().Set("Allow", res.allow)
+		}
+		r.handleError(405, ctx)
+	case res.location != "":
+		url := *req.URL
+		url.Path = res.location
+		http.Redirect(w, req, url.String(), res.status)
+	default:
+		r.handleError(res.status, ctx)
+	}
+}
+
+// tResolution is how Router handles a request, decided by resolve
+type tResolution struct {
+	// route serving the request, nil if the request is not served by a route
+	rn *RouteNode
+	// routes of the pattern matched, nil if no pattern is matched
+	m *tMap_Host_Method_RouteNode
+	// HEAD request served by GET route
+	head bool
+
+	// status replied if rn is nil, 404, 405, 406, 415, 204 of automatic OPTIONS, or the redirect code
+	status int
+	// path to redirect to
+	location string
+	// allowed methods for 405 and automatic OPTIONS
+	allow string
+}
+
+// resolve decides how to handle req of method, host and path, path is the cleaned raw_path.
+// req is used for conditions of routes. params matched are appended to *ps.
+func (r *Router) resolve(t *tRouteTable, req *http.Request, method, host, raw_path, path string, ps *Params) (res tResolution) {
+	v, redirect, substr := matchParams(t.matcher, path, ps)
 	if v == nil {
-		r.handleError(404, ctx)
+		res.status = http.StatusNotFound
 		return
 	}
 
-	ctx.Param = params
-
 	m := v.(*tMap_Host_Method_RouteNode)
+	res.m = m
+
+	rn, hostMatched, rejected := m.lookup(host, method, req, ps)
+
+	if rn == nil && hostMatched && method == "HEAD" && r.autoHEAD {
+		var get_rejected int
+		if rn, _, get_rejected = m.lookup(host, "GET", req, ps); rn != nil {
+			res.head = true
+		} else if rejected == 0 {
+			rejected = get_rejected
+		}
+	}
+
+	if !hostMatched {
+		res.status = http.StatusNotFound
+		return
+	}
 
-	var rn *RouteNode
+	if rn == nil && rejected != 0 {
+		// routes are found but their conditions are not satisfied, 406, 415 or 404
+		res.status = rejected
+		return
+	}
 
-	hostMatched := false
+	if rn == nil {
+		res.allow = r.allowedMethods(m, host)
+		if method == "OPTIONS" && r.autoOPTIONS {
+			res.status = http.StatusNoContent
+		} else {
+			res.status = http.StatusMethodNotAllowed
+		}
+		return
+	}
+
+	// "/path/" is matched by "/path" as a prefix
+	extraSlash := !redirect && len(substr) == len(path)-1 && path[len(path)-1] == '/'
+
+	// redirect if path not match exactly, according to path policy
+	// 1. redirect "/path" to "/path/" if "/path" is not registered but "/path/" is registered
+	// 2. "/path/" is served by "/path" if "/path/" is not registered, or redirected to "/path"
+	// 3. redirect "/path//sub" "/path///sub" to "/path/sub"
+	// 4. redirect "/path/sub/.." to "/path"
+	// 5. redirect "/path/sub/." to "/path/sub"
+	// ...
+	if redirect || extraSlash || path != raw_path {
+		switch r.pathPolicy.action(raw_path, path, redirect, extraSlash) {
+		case PathNotFound:
+			res.status = http.StatusNotFound
+			return
+		case PathRedirect:
+			if redirect && r.pathPolicy.TrailingSlash != PathServe {
+				res.location = path + "/"
+			} else if extraSlash && r.pathPolicy.ExtraTrailingSlash == PathRedirect {
+				res.location = substr
+			} else {
+				res.location = path
+			}
+			res.status = r.pathPolicy.redirectCode(method)
+			return
+		}
+	}
+
+	res.rn = rn
+	return
+}
+
+// lookup returns the route handling method for host, params of host pattern are appended to *ps.
+// exact host is matched first, then host patterns, then routes without host.
+// hostMatched reports whether any route of host is found, even if no route handles method.
+// if routes of method are found but rejected by their conditions, rejected is the status to reply.
+func (m *tMap_Host_Method_RouteNode) lookup(host, method string, req *http.Request, ps *Params) (rn *RouteNode, hostMatched bool, rejected int) {
+	try := func(mh tMap_Method_RouteNode) {
+		var status int
+		if rn, status = mh.route(method, req); rejected == 0 {
+			rejected = status
+		}
+	}
 
 	// Host-specific pattern takes precedence over generic ones
 	if m.shouldMatchHost {
 		if mh := m.hosts[host]; mh != nil {
 			hostMatched = true
+			try(mh)
+		}
 
-			rn = mh[req.Method]
-			if rn == nil {
-				// any method
-				rn = mh["*"]
+		// if exact host matched, rn may set already
+		for i := 0; rn == nil && i < len(m.hostPatterns); i++ {
+			hp := m.hostPatterns[i]
+			nparams := len(*ps)
+			if hp.match(host, ps) {
+				hostMatched = true
+				if try(hp.methods); rn == nil {
+					// params of host not used
+					*ps = (*ps)[:nparams]
+				}
 			}
 		}
 	}
@@ -177,47 +785,65 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if rn == nil {
 		if mh := m.hosts[""]; mh != nil {
 			hostMatched = true
-
-			rn = mh[req.Method]
-			if rn == nil {
-				// any method
-				rn = mh["*"]
-			}
+			try(mh)
 		}
 	}
 
-	if !hostMatched {
-		r.handleError(404, ctx)
-		return
+	if rn != nil {
+		rejected = 0
 	}
 
-	if rn == nil {
-		r.handleError(405, ctx)
-		return
-	}
+	return
+}
 
-	// redirect if path not match exactly
-	// 1. redirect "/path" to "/path/" if "/path" is not registered but "/path/" is registered
-	// 2. redirect "/path//sub" "/path///sub" to "/path/sub"
-	// 3. redirect "/path/sub/.." to "/path"
-	// 4. redirect "/path/sub/." to "/path/sub"
-	// ...
-	if redirect || path != req.URL.Path {
-		url := *req.URL
-		if redirect {
-			url.Path = path + "/"
-		} else {
-			url.Path = path
+// allowedMethods returns value of Allow header, which is the methods of all routes found for host
+func (r *Router) allowedMethods(m *tMap_Host_Method_RouteNode, host string) string {
+	allowed := make(map[string]bool)
+
+	add := func(mh tMap_Method_RouteNode) {
+		for method := range mh {
+			allowed[method] = true
 		}
-		http.Redirect(w, req, url.String(), http.StatusTemporaryRedirect)
-		return
 	}
 
-	for _, h := range rn.handlers {
-		if next := h.call(ctx); !next {
-			break
+	if m.shouldMatchHost {
+		add(m.hosts[host])
+
+		var ps Params
+		for _, hp := range m.hostPatterns {
+			if hp.match(host, &ps) {
+				add(hp.methods)
+			}
 		}
 	}
+	add(m.hosts[""])
+
+	// the route handling any method is never in Allow header, because 405 won't happen
+	delete(allowed, "*")
+
+	if allowed["GET"] && r.autoHEAD {
+		allowed["HEAD"] = true
+	}
+	if r.autoOPTIONS {
+		allowed["OPTIONS"] = true
+	}
+
+	methods := make([]string, 0, len(allowed))
+	for method := range allowed {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	return strings.Join(methods, ", ")
+}
+
+// headResponseWriter discards response body of HEAD request served by GET route
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
 }
 
 func (r *Router) handleError(code int, ctx *Context) {
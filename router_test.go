@@ -2,6 +2,7 @@ package iafon
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -27,6 +28,20 @@ func TestServeHTTP(t *testing.T) {
 	}
 }
 
+// testEchoPaths requests GET paths by r, handlers set echo to the value expected of path
+func testEchoPaths(t *testing.T, name string, r http.Handler, echo *string, paths map[string]string) {
+	for path, expected := range paths {
+		*echo = ""
+
+		req, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+		r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+
+		if *echo != expected {
+			t.Fatalf("%s error. req path: %s, expected: %s, got: %s", name, path, expected, *echo)
+		}
+	}
+}
+
 type MockResponseWriter struct {
 	header http.Header
 	code   int
@@ -77,3 +92,717 @@ func TestRedirect(t *testing.T) {
 		}
 	}
 }
+
+func TestCatchAllParam(t *testing.T) {
+	var echo string
+
+	r := newRouter()
+	r.GET("/static/*filepath", func(c *Context) {
+		echo = c.Param["filepath"]
+	})
+
+	var paths = map[string]string{
+		"/static/css/app.css":  "css/app.css",
+		"/static/js/lib/a.js":  "js/lib/a.js",
+		"/static/":             "",
+		"/static/index.html/x": "index.html/x",
+	}
+
+	for path, filepath := range paths {
+		echo = "-"
+
+		req, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+		r.ServeHTTP(nil, req)
+
+		if echo != filepath {
+			t.Fatalf("catch-all param error. req path: %s, expected: %s, got: %s", path, filepath, echo)
+		}
+	}
+}
+
+func TestParamConstraint(t *testing.T) {
+	var echo string
+
+	r := newRouter()
+	r.GET(`/user/:id<\d+>`, func(c *Context) {
+		echo = "id " + c.Param["id"]
+	})
+	r.GET(`/user/:name<[a-z]+>`, func(c *Context) {
+		echo = "name " + c.Param["name"]
+	})
+	r.HandleError(404, func(c *Context) {
+		echo = "404"
+	})
+
+	var paths = map[string]string{
+		"/user/42":  "id 42",
+		"/user/bob": "name bob",
+		"/user/B0b": "404",
+	}
+
+	testEchoPaths(t, "param constraint", r, &echo, paths)
+}
+
+func TestExpandPattern(t *testing.T) {
+	var cases = map[string][]string{
+		"/report":                  {"/report"},
+		"/report(/:format)?":       {"/report/:format", "/report"},
+		"/a(/b(/c)?)?":             {"/a/b/c", "/a/b", "/a"},
+		"/a(/b)?/c(/d)?":           {"/a/b/c/d", "/a/c/d", "/a/b/c", "/a/c"},
+		`/user/:id<(\d+)>(/edit)?`: {`/user/:id<(\d+)>/edit`, `/user/:id<(\d+)>`},
+	}
+
+	for pattern, expected := range cases {
+		patterns := expandPattern(pattern)
+		if strings.Join(patterns, " ") != strings.Join(expected, " ") {
+			t.Fatalf("expand pattern '%s' error, expected %v, got %v", pattern, expected, patterns)
+		}
+	}
+
+	for _, pattern := range []string{"/a(/b", "/a(/b)", "/a/b)?", "/a()?"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("invalid optional segment '%s' should panic", pattern)
+				}
+			}()
+			expandPattern(pattern)
+		}()
+	}
+}
+
+func TestOptionalSegmentAndAlias(t *testing.T) {
+	var echo string
+
+	r := newRouter()
+
+	g := r.Group("/api")
+
+	rn := g.GET("/report(/:format)?", func(c *Context) {
+		echo += "report " + c.Param["format"]
+	})
+	rn.Alias("/summary")
+	rn.UseMiddleware(newMiddleware(1))
+
+	var paths = map[string]string{
+		"/api/report":     "report ",
+		"/api/report/csv": "report csv",
+		"/api/summary":    "report ",
+	}
+
+	for path, expected := range paths {
+		echo = ""
+		execSequence = []int{}
+		stopMiddlewareIndex = 0
+
+		req, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+		r.ServeHTTP(nil, req)
+
+		if echo != expected {
+			t.Fatalf("optional segment or alias error. req path: %s, expected: %s, got: %s", path, expected, echo)
+		}
+
+		if len(execSequence) != 1 || execSequence[0] != 1 {
+			t.Fatalf("middleware is not shared by patterns of route. req path: %s", path)
+		}
+	}
+
+	if patterns := rn.load().patterns; len(patterns) != 3 {
+		t.Fatalf("route should have 3 patterns, got %v", patterns)
+	}
+
+	if routes := r.GetRoutes(); len(routes) != 1 {
+		t.Fatalf("optional segments should not add more routes, got %d", len(routes))
+	}
+}
+
+func TestSetMatcher(t *testing.T) {
+	var echo string
+
+	r := newRouter().SetMatcher(&PatternMapByList{})
+
+	r.GET("/user/:id<int>", func(c *Context) {
+		echo = "id " + c.Param["id"]
+	})
+	r.GET("/user/:name", func(c *Context) {
+		echo = "name " + c.Param["name"]
+	})
+	r.GET("/files/*filepath", func(c *Context) {
+		echo = "file " + c.Param["filepath"]
+	})
+
+	var paths = map[string]string{
+		"/user/42":        "id 42",
+		"/user/bob":       "name bob",
+		"/files/a/b.css":  "file a/b.css",
+		"/files/":         "file ",
+		"/not/registered": "",
+	}
+
+	testEchoPaths(t, "list matcher", r, &echo, paths)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("setting matcher after adding routes should panic")
+		}
+	}()
+	r.SetMatcher(&PatternMapByTree{})
+}
+
+// TestMatchOnlyMatcher implements PatternMapInterface only, like matchers written before MatchParams
+type TestMatchOnlyMatcher struct {
+	list PatternMapByList
+}
+
+func (m *TestMatchOnlyMatcher) Set(pattern string, value interface{}) { m.list.Set(pattern, value) }
+func (m *TestMatchOnlyMatcher) Get(pattern string) interface{}        { return m.list.Get(pattern) }
+func (m *TestMatchOnlyMatcher) Len() int                              { return m.list.Len() }
+
+func (m *TestMatchOnlyMatcher) Match(str string) (interface{}, map[string]string, bool, string) {
+	return m.list.Match(str)
+}
+
+func TestSetMatcherMatchOnly(t *testing.T) {
+	var echo string
+
+	r := newRouter().SetMatcher(&TestMatchOnlyMatcher{})
+
+	r.GET("/user/:name/posts/:id", func(c *Context) {
+		echo = c.Param["name"] + " " + c.Params.Get("id")
+	})
+	r.GET("/about", func(c *Context) {
+		echo = "about"
+	})
+
+	var paths = map[string]string{
+		"/user/bob/posts/1": "bob 1",
+		"/about":            "about",
+		"/user/bob":         "",
+	}
+
+	testEchoPaths(t, "match only matcher", r, &echo, paths)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("removing route of matcher without Delete should panic")
+		}
+	}()
+	r.Remove("GET", "/about")
+}
+
+func TestHostPatternRoute(t *testing.T) {
+	var echo string
+
+	r := newRouter()
+
+	r.GET("/dashboard", func(c *Context) {
+		echo = "generic"
+	})
+	r.GET("admin.example.com/dashboard", func(c *Context) {
+		echo = "admin"
+	})
+	r.GET(":tenant.example.com/dashboard", func(c *Context) {
+		echo = "tenant " + c.Param["tenant"]
+	})
+	r.GET("*.example.com/health", func(c *Context) {
+		echo = "health"
+	})
+
+	g := r.Group(":tenant.example.com")
+	g.GET("/user/:id", func(c *Context) {
+		echo = "user " + c.Param["tenant"] + " " + c.Param["id"]
+	}).Name("tenant.user")
+
+	var urls = map[string]string{
+		"http://admin.example.com/dashboard":     "admin",
+		"http://acme.example.com/dashboard":      "tenant acme",
+		"http://acme.example.com:8080/dashboard": "tenant acme",
+		"http://a.b.example.com/dashboard":       "generic",
+		"http://localhost/dashboard":             "generic",
+		"http://acme.example.com/health":         "health",
+		"http://example.com/health":              "",
+		"http://acme.example.com/user/42":        "user acme 42",
+	}
+
+	for url, expected := range urls {
+		echo = ""
+
+		req, _ := http.NewRequest("GET", url, nil)
+		r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+
+		if echo != expected {
+			t.Fatalf("host pattern route error. req url: %s, expected: %s, got: %s", url, expected, echo)
+		}
+	}
+
+	if url := r.URL("tenant.user", "tenant", "acme", "id", "42"); url != "//acme.example.com/user/42" {
+		t.Fatalf("url of host pattern route error, got %s", url)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("param in both host and path should panic")
+			}
+		}()
+		r.GET(":id.example.com/item/:id", func(c *Context) {})
+	}()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("param in both host and path should panic, even if the host pattern is added before")
+			}
+		}()
+		g.POST("/user/:tenant", func(c *Context) {})
+	}()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("host in sub group prefix should panic")
+			}
+		}()
+		r.Group("/admin").Group(":tenant.example.com")
+	}()
+}
+
+func TestAutoHEADAndOPTIONS(t *testing.T) {
+	var echo string
+
+	r := newRouter()
+
+	r.GET("/user/:id", func(c *Context) {
+		echo = "get " + c.Param["id"]
+		c.Rsp.Write([]byte("body"))
+	})
+	r.PUT("/user/:id", func(c *Context) {})
+	r.GET("x.org/user/:id", func(c *Context) {})
+	r.DELETE("x.org/user/:id", func(c *Context) {})
+	r.OPTIONS("/options", func(c *Context) {
+		echo = "options"
+	})
+
+	// HEAD is served by GET route without body
+	w := &MockResponseWriter{header: http.Header{}}
+	req, _ := http.NewRequest("HEAD", "http://localhost/user/42", nil)
+	r.ServeHTTP(w, req)
+	if echo != "get 42" || w.data != "" {
+		t.Fatalf("HEAD should be served by GET route without body, got echo '%s', body '%s'", echo, w.data)
+	}
+
+	// OPTIONS is answered with allowed methods, methods of host and generic routes are merged
+	w = &MockResponseWriter{header: http.Header{}}
+	req, _ = http.NewRequest("OPTIONS", "http://x.org/user/42", nil)
+	r.ServeHTTP(w, req)
+	if allow := w.Header().Get("Allow"); w.code != http.StatusNoContent || allow != "DELETE, GET, HEAD, OPTIONS, PUT" {
+		t.Fatalf("OPTIONS should be answered automatically, got code %d, Allow '%s'", w.code, allow)
+	}
+
+	// OPTIONS route added takes precedence
+	echo = ""
+	req, _ = http.NewRequest("OPTIONS", "http://localhost/options", nil)
+	r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+	if echo != "options" {
+		t.Fatal("OPTIONS route added should handle OPTIONS request")
+	}
+
+	w = &MockResponseWriter{header: http.Header{}}
+	req, _ = http.NewRequest("POST", "http://localhost/user/42", nil)
+	r.ServeHTTP(w, req)
+	if allow := w.Header().Get("Allow"); w.code != 405 || allow != "GET, HEAD, OPTIONS, PUT" {
+		t.Fatalf("405 response should have Allow header, got code %d, Allow '%s'", w.code, allow)
+	}
+
+	r.SetAutoHEAD(false).SetAutoOPTIONS(false).SetAllowHeader(false)
+
+	for _, method := range []string{"HEAD", "OPTIONS"} {
+		w = &MockResponseWriter{header: http.Header{}}
+		req, _ = http.NewRequest(method, "http://localhost/user/42", nil)
+		r.ServeHTTP(w, req)
+		if w.code != 405 || w.Header().Get("Allow") != "" {
+			t.Fatalf("%s should not be handled automatically when disabled, got code %d, Allow '%s'", method, w.code, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestPathPolicy(t *testing.T) {
+	var echo string
+
+	var handler = func(c *Context) {
+		echo = c.Req.URL.Path
+	}
+
+	cases := []struct {
+		policy   PathPolicy
+		method   string
+		path     string
+		code     int
+		location string
+		echo     string
+	}{
+		// default policy
+		{PathPolicy{}, "GET", "/user", 307, "/user/", ""},
+		{PathPolicy{}, "GET", "/item/", 0, "", "/item/"},
+		{PathPolicy{}, "GET", "/user//42", 307, "/user/42", ""},
+		{PathPolicy{}, "POST", "/user/./42", 307, "/user/42", ""},
+
+		// strict
+		{PathPolicy{TrailingSlash: PathNotFound, ExtraTrailingSlash: PathNotFound}, "GET", "/user", 404, "", ""},
+		{PathPolicy{TrailingSlash: PathNotFound, ExtraTrailingSlash: PathNotFound}, "GET", "/item/", 404, "", ""},
+		{PathPolicy{DuplicateSlash: PathNotFound}, "GET", "/user//42", 404, "", ""},
+		{PathPolicy{DotSegment: PathNotFound}, "GET", "/user/x/../42", 404, "", ""},
+		{PathPolicy{DotSegment: PathNotFound}, "GET", "/user//42", 307, "/user/42", ""},
+
+		// lenient
+		{PathPolicy{TrailingSlash: PathServe}, "GET", "/user", 0, "", "/user"},
+		{PathPolicy{DuplicateSlash: PathServe, DotSegment: PathServe}, "GET", "/user//./42", 0, "", "/user//./42"},
+		{PathPolicy{ExtraTrailingSlash: PathRedirect}, "GET", "/item/", 307, "/item", ""},
+
+		// the most severe action wins
+		{PathPolicy{TrailingSlash: PathServe, DuplicateSlash: PathNotFound}, "GET", "//user", 404, "", ""},
+
+		// status code
+		{PathPolicy{RedirectCode: 301, RedirectCodeOther: 308}, "GET", "/user", 301, "/user/", ""},
+		{PathPolicy{RedirectCode: 301, RedirectCodeOther: 308}, "POST", "/user", 308, "/user/", ""},
+	}
+
+	for _, c := range cases {
+		r := newRouter().SetPathPolicy(c.policy)
+		r.Some([]string{"GET", "POST"}, "/user/", handler)
+		r.Some([]string{"GET", "POST"}, "/user/:id", handler)
+		r.GET("/item", handler)
+
+		echo = ""
+
+		w := &MockResponseWriter{header: http.Header{}}
+		req, _ := http.NewRequest(c.method, "http://localhost"+c.path, nil)
+		r.ServeHTTP(w, req)
+
+		location := strings.TrimPrefix(w.Header().Get("Location"), "http://localhost")
+
+		if w.code != c.code || location != c.location || echo != c.echo {
+			t.Fatalf("path policy %+v error. %s %s, expected %d '%s' '%s', got %d '%s' '%s'", c.policy, c.method, c.path,
+				c.code, c.location, c.echo, w.code, location, echo)
+		}
+	}
+}
+
+func TestRemoveRoute(t *testing.T) {
+	var echo string
+
+	r := newRouter()
+
+	r.GET("/user/:id", func(c *Context) {
+		echo = "get user"
+	})
+	r.PUT("/user/:id", func(c *Context) {
+		echo = "put user"
+	})
+	rn := r.GET("/report(/:format)?", func(c *Context) {
+		echo = "report"
+	}).Alias("/summary").Name("report")
+	r.GET(":tenant.example.com/dashboard", func(c *Context) {
+		echo = "dashboard"
+	})
+
+	serve := func(method, url string) string {
+		echo = ""
+		req, _ := http.NewRequest(method, url, nil)
+		r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+		return echo
+	}
+
+	if serve("GET", "http://localhost/report/csv") != "report" || serve("GET", "http://acme.example.com/dashboard") != "dashboard" {
+		t.Fatal("routes are not served before removed")
+	}
+
+	rn.Remove()
+
+	for _, url := range []string{"http://localhost/report", "http://localhost/report/csv", "http://localhost/summary"} {
+		if serve("GET", url) != "" {
+			t.Fatalf("removed route should not be served, url: %s", url)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("url of removed route should panic")
+			}
+		}()
+		r.URL("report")
+	}()
+
+	if !r.Remove("get", "/user/:id") {
+		t.Fatal("fail to remove route")
+	}
+	if r.Remove("GET", "/user/:id") || r.Remove("GET", "/not/added") {
+		t.Fatal("remove route not added should return false")
+	}
+	if serve("GET", "http://localhost/user/42") != "" || serve("PUT", "http://localhost/user/42") != "put user" {
+		t.Fatal("only the route of method removed should not be served")
+	}
+
+	if !r.Remove("GET", ":tenant.example.com/dashboard") || serve("GET", "http://acme.example.com/dashboard") != "" {
+		t.Fatal("fail to remove route of host pattern")
+	}
+
+	if routes := r.GetRoutes(); len(routes) != 1 || routes[0].method != "PUT" {
+		t.Fatalf("removed routes should not be in route group, got\n%s", routes)
+	}
+
+	// pattern and name could be added again
+	r.GET("/report", func(c *Context) {
+		echo = "report again"
+	}).Name("report")
+	if serve("GET", "http://localhost/report") != "report again" {
+		t.Fatal("route removed could be added again")
+	}
+}
+
+func TestRouteUpdateWhileServing(t *testing.T) {
+	r := newRouter()
+	r.GET("/static", func(c *Context) {})
+
+	done := make(chan bool)
+
+	go func() {
+		for i := 0; i < 200; i++ {
+			pattern := "/tenant" + strconv.Itoa(i%10) + "/:id"
+			if !r.Remove("GET", pattern) {
+				r.GET(pattern, func(c *Context) {})
+			}
+		}
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		w := &MockResponseWriter{header: http.Header{}}
+		req, _ := http.NewRequest("GET", "http://localhost/static", nil)
+		r.ServeHTTP(w, req)
+		if w.code != 0 {
+			t.Fatalf("route not changed should always be served, got %d", w.code)
+		}
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	var echo string
+
+	r := newRouter()
+	r.GET("/user/:id", func(c *Context) {
+		echo = "user " + c.Param["id"]
+	})
+	r.GET("/static/*filepath", &IafonHandlerForFreeze{&echo})
+	rn := r.GET("/", func(w http.ResponseWriter, req *http.Request) {
+		echo = "root"
+	})
+
+	if err := r.Freeze(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Freeze(); err != nil {
+		t.Fatal("freezing again should do nothing, got", err)
+	}
+
+	var paths = map[string]string{
+		"/user/42":       "user 42",
+		"/static/a/b.js": "static a/b.js",
+		"/":              "root",
+	}
+
+	testEchoPaths(t, "frozen router", r, &echo, paths)
+
+	changes := map[string]func(){
+		"add":        func() { r.GET("/new", func(c *Context) {}) },
+		"remove":     func() { r.Remove("GET", "/user/:id") },
+		"alias":      func() { rn.Alias("/index") },
+		"name":       func() { rn.Name("root") },
+		"middleware": func() { rn.UseMiddleware(&TestMiddleware{}) },
+		"matcher":    func() { r.SetMatcher(&PatternMapByList{}) },
+	}
+
+	for name, change := range changes {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s after freezing should panic", name)
+				}
+			}()
+			change()
+		}()
+	}
+
+	r = newRouter()
+	r.GET("/user/:id/post/:id", func(c *Context) {})
+	if err := r.Freeze(); err == nil {
+		t.Fatal("freezing invalid routes should fail")
+	}
+}
+
+type IafonHandlerForFreeze struct {
+	echo *string
+}
+
+func (h *IafonHandlerForFreeze) Handle(c *Context) {
+	*h.echo = "static " + c.Param["filepath"]
+}
+
+func TestValidate(t *testing.T) {
+	r := newRouter()
+	h := func(c *Context) {}
+
+	r.GET("/user/:id", h)
+	r.GET("/user/:name", h)
+	r.POST("/post/:id", h)
+	r.PUT("/post/:pid", h)
+	r.GET("/handler/http", h)
+	r.GET("/handler/:param_name", h)
+	r.GET("/team/:tid", h)
+	r.GET("/team/:team_id/members", h)
+	r.GET("/page", h)
+	r.GET("x.org/page", h)
+	r.GET("/files/:name<int>", h)
+	r.GET("/files/:file", h)
+
+	var expected = map[string]RouteIssueKind{
+		"GET /user/:name":          IssueConflict,
+		"PUT /post/:pid":           IssueConflict,
+		"GET /handler/:param_name": IssueShadowed,
+		"GET /page":                IssueHostOverride,
+		"GET /team/:tid":           IssueAmbiguousParam,
+		"GET /files/:file":         IssueShadowed,
+	}
+
+	report := r.Validate()
+	if len(report.Issues) != len(expected) {
+		t.Fatalf("validate error. expected %d issues, got:\n%s", len(expected), report)
+	}
+	for _, issue := range report.Issues {
+		route := issue.Route.method + " " + issue.Pattern
+		if expected[route] != issue.Kind {
+			t.Fatalf("validate error. route: %s, expected: %s, got: %s", route, expected[route], issue)
+		}
+	}
+	if !report.HasErrors() {
+		t.Fatal("conflict should be an error")
+	}
+	if err := r.Freeze(); err == nil {
+		t.Fatal("freezing conflicting routes should fail")
+	}
+
+	r = newRouter()
+	r.GET("/user/:id", h)
+	r.GET("/user/:id/posts", h)
+	if report := r.Validate(); len(report.Issues) != 0 {
+		t.Fatal("validate error. expected no issue, got:", report)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	r := newRouter()
+	h := func(c *Context) {}
+
+	r.GET("/handler/:param_name", h)
+	r.GET("/handler/http", h)
+	r.GET("/page", h)
+	r.GET("x.org/page", h)
+
+	var tests = []struct {
+		method, host, path string
+		pattern            string
+		status             int
+		reason             string
+	}{
+		{"GET", "localhost", "/handler/http", "/handler/http", 200, "static text 'http' is tried before param ':param_name'"},
+		{"GET", "localhost", "/handler/42", "/handler/:param_name", 200, "route without host"},
+		{"GET", "x.org:8080", "/page", "x.org/page", 200, "host matches 'x.org' exactly"},
+		{"GET", "y.org", "/page", "/page", 200, "no route of host 'y.org'"},
+		{"HEAD", "y.org", "/page", "/page", 200, "HEAD request is served by GET route"},
+		{"POST", "y.org", "/page", "", 405, "allowed methods are GET, HEAD, OPTIONS"},
+		{"GET", "y.org", "/page/../page", "", 307, "redirected to '/page'"},
+		{"GET", "y.org", "/none", "", 404, "no pattern matches path"},
+	}
+
+	for _, test := range tests {
+		e := r.Explain(test.method, test.host, test.path)
+		if e.Pattern != test.pattern || e.Status != test.status || !strings.Contains(e.String(), test.reason) {
+			t.Fatalf("explain error. expected: %s %d %s, got:\n%s", test.pattern, test.status, test.reason, e)
+		}
+	}
+
+	e := r.Explain("GET", "localhost", "/handler/42")
+	if e.Params.Get("param_name") != "42" {
+		t.Fatal("explain error. param not matched:", e.Params)
+	}
+}
+
+func TestRegisterMethod(t *testing.T) {
+	var echo string
+
+	r := newRouter()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("adding route of method not registered should panic")
+			}
+		}()
+		r.Handle("PROPFIND", "/dav/*path", func(c *Context) {})
+	}()
+
+	r.RegisterMethod("PROPFIND", "mkcol", "PURGE")
+	r.Handle("PROPFIND", "/dav/*path", func(c *Context) {
+		echo = "PROPFIND " + c.Param["path"]
+	})
+	r.Some([]string{"MKCOL", "purge"}, "/dav/*path", func(c *Context) {
+		echo = c.Req.Method + " " + c.Param["path"]
+	})
+
+	for _, method := range []string{"PROPFIND", "MKCOL", "PURGE"} {
+		echo = ""
+		req, _ := http.NewRequest(method, "http://localhost/dav/a/b", nil)
+		r.ServeHTTP(&MockResponseWriter{header: http.Header{}}, req)
+		if echo != method+" a/b" {
+			t.Fatalf("custom method error. method: %s, got: %s", method, echo)
+		}
+	}
+
+	w := &MockResponseWriter{header: http.Header{}}
+	req, _ := http.NewRequest("LOCK", "http://localhost/dav/a", nil)
+	r.ServeHTTP(w, req)
+	if allow := w.Header().Get("Allow"); w.code != 405 || allow != "MKCOL, OPTIONS, PROPFIND, PURGE" {
+		t.Fatalf("method not registered should get 405, got code %d, Allow '%s'", w.code, allow)
+	}
+
+	for _, method := range []string{"", "BAD METHOD", "GET/1", "LOCK\n"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("registering invalid method token '%s' should panic", method)
+				}
+			}()
+			r.RegisterMethod(method)
+		}()
+	}
+}
+
+func BenchmarkGithubValidate(b *testing.B) {
+	r := newRouter()
+	for _, route := range githubAPI {
+		parts := strings.SplitN(route, " ", 2)
+		r.Handle(parts[0], parts[1], func(*Context) {})
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Validate()
+	}
+}
@@ -26,11 +26,24 @@ func NewServer(addr ...string) *Server {
 	return s
 }
 
+// NewServerWithMatcher creates a server whose router uses matcher to match path with route patterns
+func NewServerWithMatcher(matcher PatternMapInterface, addr ...string) *Server {
+	s := NewServer(addr...)
+	s.SetMatcher(matcher)
+	return s
+}
+
 func (s *Server) Run() error {
-	if s.matcher.Len() == 0 {
+	if s.routeTable().matcher.Len() == 0 {
 		return errors.New("no route added, can not run.")
 	}
 
+	if s.freezeOnRun {
+		if err := s.Freeze(); err != nil {
+			return err
+		}
+	}
+
 	fmt.Println("listening on " + s.Addr)
 
 	err := s.ListenAndServe()
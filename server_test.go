@@ -36,6 +36,27 @@ func TestRunWithRoute(t *testing.T) {
 	if err != nil && err.Error() != "http: Server closed" {
 		t.Fatal("Run failed")
 	}
+	if s.isFrozen() {
+		t.Fatal("Run should not freeze routes unless SetFreezeOnRun(true) is called")
+	}
+}
+
+func TestRunWithFreeze(t *testing.T) {
+	s := NewServer("127.0.0.1:")
+	s.Handle("GET", "/", func(http.ResponseWriter, *http.Request) {})
+	s.SetFreezeOnRun(true)
+
+	go func() {
+		time.Sleep(time.Millisecond)
+		s.Close()
+	}()
+
+	if err := s.Run(); err != nil && err.Error() != "http: Server closed" {
+		t.Fatal("Run failed")
+	}
+	if !s.isFrozen() {
+		t.Fatal("Run should freeze routes if SetFreezeOnRun(true) is called")
+	}
 }
 
 func TestRunServers(t *testing.T) {
@@ -0,0 +1,322 @@
+package iafon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StaticOptions configures files served by RouteGroup.Static
+type StaticOptions struct {
+	// file served for directory, "index.html" by default
+	Index string
+
+	// list files of directory which has no index file, disabled by default
+	ListDirectory bool
+
+	// file served for paths not found under prefix, like "index.html" of single page app.
+	// the 404 error handler is used if Fallback is empty.
+	Fallback string
+
+	// serve "file.br" or "file.gz" instead of "file" if it exists and the encoding is accepted by request
+	Precompressed bool
+
+	// value of Cache-Control header, not sent if empty
+	CacheControl string
+}
+
+// tStaticFiles serves files of fsys
+type tStaticFiles struct {
+	fsys    fs.FS
+	options StaticOptions
+
+	// strong ETag of files computed by file content, see precomputeETags and etag
+	etags sync.Map
+}
+
+type tStaticETag struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// Static serves files of fsys under prefix for GET requests, fsys could be embed.FS or os.DirFS.
+// HEAD requests are served by the GET route unless it is disabled by Router.SetAutoHEAD.
+// "/assets/css/app.css" under prefix "/assets" is served by file "css/app.css" of fsys.
+// strong ETag is computed by file content, If-None-Match, If-Modified-Since and Range are supported.
+// ETags of embed.FS are computed by Static, ETags of other file systems are computed when file is
+// requested first, and computed again if size or modification time of file changes.
+func (g *RouteGroup) Static(prefix string, fsys fs.FS, options ...StaticOptions) *RouteNode {
+	if fsys == nil {
+		panic("http: nil file system")
+	}
+
+	s := &tStaticFiles{fsys: fsys}
+	if len(options) > 0 {
+		s.options = options[0]
+	}
+	if s.options.Index == "" {
+		s.options.Index = "index.html"
+	}
+
+	// files of embed.FS never change
+	if _, ok := fsys.(embed.FS); ok {
+		s.precomputeETags()
+	}
+
+	return g.handleUnder("GET", prefix, "filepath", s.serve)
+}
+
+func (s *tStaticFiles) serve(c *Context) {
+	raw_name := c.Param["filepath"]
+
+	// path.Clean removes "..", name could not escape fsys
+	name := strings.TrimPrefix(path.Clean("/"+raw_name), "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) || strings.IndexByte(name, '\\') >= 0 {
+		s.notFound(c)
+		return
+	}
+
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		s.notFound(c)
+		return
+	}
+
+	if info.IsDir() {
+		// relative links of index file and directory listing need the trailing slash
+		if !strings.HasSuffix(c.Req.URL.Path, "/") {
+			url := *c.Req.URL
+			url.Path += "/"
+			http.Redirect(c.Rsp, c.Req, url.String(), http.StatusMovedPermanently)
+			return
+		}
+
+		index := path.Join(name, s.options.Index)
+		if index_info, err := fs.Stat(s.fsys, index); err == nil && !index_info.IsDir() {
+			s.serveFile(c, index, index_info)
+			return
+		}
+
+		if s.options.ListDirectory {
+			s.listDirectory(c, name)
+			return
+		}
+
+		s.notFound(c)
+		return
+	}
+
+	s.serveFile(c, name, info)
+}
+
+// notFound serves the fallback file, or replies by the 404 error handler
+func (s *tStaticFiles) notFound(c *Context) {
+	if s.options.Fallback != "" {
+		if info, err := fs.Stat(s.fsys, s.options.Fallback); err == nil && !info.IsDir() {
+			s.serveFile(c, s.options.Fallback, info)
+			return
+		}
+	}
+	c.router.handleError(404, c)
+}
+
+// serveFile serves file name, or its pre-compressed sibling
+func (s *tStaticFiles) serveFile(c *Context, name string, info fs.FileInfo) {
+	header := c.Rsp.Header()
+
+	if s.options.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+
+		for _, encoding := range [2][2]string{{"br", ".br"}, {"gzip", ".gz"}} {
+			if !acceptsEncoding(c.Req.Header.Get("Accept-Encoding"), encoding[0]) {
+				continue
+			}
+			if compressed_info, err := fs.Stat(s.fsys, name+encoding[1]); err == nil && !compressed_info.IsDir() {
+				header.Set("Content-Encoding", encoding[0])
+				// http.ServeContent sniffs the compressed content if the type is unknown by extension
+				if header.Get("Content-Type") == "" {
+					header.Set("Content-Type", s.contentType(name))
+				}
+				s.serveContent(c, name, name+encoding[1], compressed_info)
+				return
+			}
+		}
+	}
+
+	s.serveContent(c, name, name, info)
+}
+
+// serveContent serves content of file, content type is decided by extension of name
+func (s *tStaticFiles) serveContent(c *Context, name, file string, info fs.FileInfo) {
+	f, err := s.fsys.Open(file)
+	if err != nil {
+		// not s.notFound, the fallback file may fail to open too
+		c.router.handleError(404, c)
+		return
+	}
+	defer f.Close()
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			panic(fmt.Sprintf("http: fail to read static file %s, %s", file, err))
+		}
+		content = bytes.NewReader(data)
+	}
+
+	etag, err := s.etag(file, info, content)
+	if err != nil {
+		panic(fmt.Sprintf("http: fail to read static file %s, %s", file, err))
+	}
+
+	header := c.Rsp.Header()
+	header.Set("ETag", etag)
+	if s.options.CacheControl != "" {
+		header.Set("Cache-Control", s.options.CacheControl)
+	}
+
+	// handles If-None-Match, If-Modified-Since and Range
+	http.ServeContent(c.Rsp, c.Req, name, info.ModTime(), content)
+}
+
+// contentType returns content type of file name by its extension, or by sniffing its content
+func (s *tStaticFiles) contentType(name string) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+
+	// http.DetectContentType reads at most 512 bytes
+	var buf [512]byte
+	n, _ := io.ReadFull(f, buf[:])
+	return http.DetectContentType(buf[:n])
+}
+
+// precomputeETags computes ETags of all files, so requests do not read file for ETag
+func (s *tStaticFiles) precomputeETags() {
+	err := fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, err := s.fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = s.computeETag(name, info, f)
+		return err
+	})
+	if err != nil {
+		panic("http: fail to read static files, " + err.Error())
+	}
+}
+
+// etag returns strong ETag of file, which is computed once unless size or modification time of file changes
+func (s *tStaticFiles) etag(file string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if v, ok := s.etags.Load(file); ok {
+		e := v.(tStaticETag)
+		if e.size == info.Size() && e.modTime.Equal(info.ModTime()) {
+			return e.etag, nil
+		}
+	}
+
+	etag, err := s.computeETag(file, info, content)
+	if err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return etag, nil
+}
+
+// computeETag computes ETag of file by its content, and keeps it for requests
+func (s *tStaticFiles) computeETag(file string, info fs.FileInfo, content io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	s.etags.Store(file, tStaticETag{size: info.Size(), modTime: info.ModTime(), etag: etag})
+
+	return etag, nil
+}
+
+// listDirectory replies files of directory name as html
+func (s *tStaticFiles) listDirectory(c *Context, name string) {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		s.notFound(c)
+		return
+	}
+
+	c.Rsp.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	var b strings.Builder
+	b.WriteString("<pre>\n")
+	for _, entry := range entries {
+		entry_name := entry.Name()
+		if entry.IsDir() {
+			entry_name += "/"
+		}
+		link := url.URL{Path: entry_name}
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", link.String(), html.EscapeString(entry_name))
+	}
+	b.WriteString("</pre>\n")
+
+	if c.Req.Method != "HEAD" {
+		io.WriteString(c.Rsp, b.String())
+	}
+}
+
+// acceptsEncoding reports whether Accept-Encoding header accepts encoding
+func acceptsEncoding(accept_encoding, encoding string) bool {
+	for _, item := range strings.Split(accept_encoding, ",") {
+		token := strings.TrimSpace(item)
+		q := ""
+		if pos := strings.IndexByte(token, ';'); pos >= 0 {
+			token, q = strings.TrimSpace(token[:pos]), strings.TrimSpace(token[pos+1:])
+		}
+		if !strings.EqualFold(token, encoding) {
+			continue
+		}
+		if strings.HasPrefix(q, "q=") {
+			if v, err := strconv.ParseFloat(q[2:], 64); err == nil && v <= 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package iafon
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"net/http"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func newStaticTestFS() fstest.MapFS {
+	mod_time := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return fstest.MapFS{
+		"index.html":        {Data: []byte("<h1>home</h1>"), ModTime: mod_time},
+		"css/app.css":       {Data: []byte("body{}"), ModTime: mod_time},
+		"js/app.js":         {Data: []byte("console.log('app')"), ModTime: mod_time},
+		"js/app.js.gz":      {Data: []byte("gzip"), ModTime: mod_time},
+		"js/app.js.br":      {Data: []byte("br"), ModTime: mod_time},
+		"docs/a.txt":        {Data: []byte("a"), ModTime: mod_time},
+		"docs/sub/b.txt":    {Data: []byte("b"), ModTime: mod_time},
+		"empty/placeholder": {Data: []byte(""), ModTime: mod_time},
+		"LICENSE":           {Data: []byte("MIT License"), ModTime: mod_time},
+		"LICENSE.gz":        {Data: []byte("\x1f\x8b\x08\x00"), ModTime: mod_time},
+	}
+}
+
+func serveStatic(r *Router, path string, header map[string]string) *MockResponseWriter {
+	req, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	w := &MockResponseWriter{header: http.Header{}}
+	r.ServeHTTP(w, req)
+	if w.code == 0 {
+		w.code = 200
+	}
+	return w
+}
+
+func TestStatic(t *testing.T) {
+	r := newRouter()
+	r.Static("/assets", newStaticTestFS(), StaticOptions{ListDirectory: true, Precompressed: true, CacheControl: "max-age=60"})
+	r.HandleError(404, func(c *Context) {
+		c.Rsp.WriteHeader(404)
+		c.Rsp.Write([]byte("custom 404"))
+	})
+
+	var tests = []struct {
+		path     string
+		header   map[string]string
+		code     int
+		body     string
+		encoding string
+	}{
+		{"/assets/css/app.css", nil, 200, "body{}", ""},
+		{"/assets/", nil, 200, "<h1>home</h1>", ""},
+		{"/assets", nil, 301, "", ""},
+		{"/assets/docs", nil, 301, "", ""},
+		{"/assets/docs/", nil, 200, "<pre>\n<a href=\"a.txt\">a.txt</a>\n<a href=\"sub/\">sub/</a>\n</pre>", ""},
+		{"/assets/none.txt", nil, 404, "custom 404", ""},
+		{"/assets/js/app.js", map[string]string{"Accept-Encoding": "gzip, br"}, 200, "br", "br"},
+		{"/assets/js/app.js", map[string]string{"Accept-Encoding": "gzip, br;q=0"}, 200, "gzip", "gzip"},
+		{"/assets/js/app.js", nil, 200, "console.log('app')", ""},
+		{"/assets/css/app.css", map[string]string{"Range": "bytes=0-3"}, 206, "body", ""},
+		{"/assets/css/app.css", map[string]string{"If-Modified-Since": "Tue, 02 Jan 2024 03:04:05 GMT"}, 304, "", ""},
+	}
+
+	for _, test := range tests {
+		w := serveStatic(r, test.path, test.header)
+		if test.code == 301 {
+			// body of redirect is written by http.Redirect
+			w.data = ""
+		}
+		if w.code != test.code || w.data != test.body || w.Header().Get("Content-Encoding") != test.encoding {
+			t.Fatalf("static error. path: %s %v, expected: %d '%s' '%s', got: %d '%s' '%s'",
+				test.path, test.header, test.code, test.body, test.encoding, w.code, w.data, w.Header().Get("Content-Encoding"))
+		}
+	}
+
+	w := serveStatic(r, "/assets/css/app.css", nil)
+	etag := w.Header().Get("ETag")
+	if len(etag) != 34 || w.Header().Get("Cache-Control") != "max-age=60" || w.Header().Get("Content-Type") != "text/css; charset=utf-8" {
+		t.Fatal("static error. unexpected header:", w.Header())
+	}
+	if w = serveStatic(r, "/assets/css/app.css", map[string]string{"If-None-Match": etag}); w.code != 304 {
+		t.Fatal("static error. If-None-Match should get 304, got:", w.code)
+	}
+
+	// compressed file has its own ETag, and content type of the original file
+	w = serveStatic(r, "/assets/js/app.js", map[string]string{"Accept-Encoding": "gzip"})
+	if w.Header().Get("ETag") == serveStatic(r, "/assets/js/app.js", nil).Header().Get("ETag") ||
+		w.Header().Get("Content-Type") != "text/javascript; charset=utf-8" {
+		t.Fatal("static error. unexpected header of compressed file:", w.Header())
+	}
+
+	// type of file without extension is sniffed from the original content, not the compressed one
+	w = serveStatic(r, "/assets/LICENSE", map[string]string{"Accept-Encoding": "gzip"})
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Fatal("static error. unexpected header of compressed file without extension:", w.Header())
+	}
+
+	req, _ := http.NewRequest("HEAD", "http://localhost/assets/css/app.css", nil)
+	w = &MockResponseWriter{header: http.Header{}}
+	r.ServeHTTP(w, req)
+	if w.data != "" || w.Header().Get("Content-Length") != "6" {
+		t.Fatal("static error. HEAD should be served without body, got:", w.Header(), w.data)
+	}
+}
+
+func TestStaticFallback(t *testing.T) {
+	r := newRouter()
+	r.Group("/app").Static("", newStaticTestFS(), StaticOptions{Fallback: "index.html"})
+
+	for _, path := range []string{"/app/users/42", "/app/empty/", "/app/"} {
+		w := serveStatic(r, path, nil)
+		if w.code != 200 || w.data != "<h1>home</h1>" {
+			t.Fatalf("static fallback error. path: %s, got: %d '%s'", path, w.code, w.data)
+		}
+	}
+
+	// path is cleaned before matching, dot segments could not escape prefix
+	r.SetPathPolicy(PathPolicy{DotSegment: PathServe})
+	if w := serveStatic(r, "/app/docs/../css/app.css", nil); w.data != "body{}" {
+		t.Fatal("static error. dot segments should be cleaned, got:", w.data)
+	}
+	if w := serveStatic(r, "/app/../../index.html", nil); w.code != 404 {
+		t.Fatal("static error. path out of prefix should not be served, got:", w.code)
+	}
+
+	w := serveStatic(r, "/app/docs/a.txt", nil)
+	if w.data != "a" {
+		t.Fatal("static fallback error. existing file should be served, got:", w.data)
+	}
+}
+
+// TestFailOpenFS finds files by Stat, but fails to open them
+type TestFailOpenFS struct {
+	fstest.MapFS
+}
+
+func (TestFailOpenFS) Open(name string) (fs.File, error) {
+	return nil, errors.New("permission denied")
+}
+
+func TestStaticFallbackOpenError(t *testing.T) {
+	r := newRouter()
+	r.Static("/app", TestFailOpenFS{newStaticTestFS()}, StaticOptions{Fallback: "index.html"})
+
+	for _, path := range []string{"/app/users/42", "/app/css/app.css"} {
+		if w := serveStatic(r, path, nil); w.code != 404 {
+			t.Fatalf("static error. file failing to open should get 404, path: %s, got: %d", path, w.code)
+		}
+	}
+}
+
+//go:embed testdata/static
+var staticTestEmbedFS embed.FS
+
+func TestStaticEmbedETag(t *testing.T) {
+	s := &tStaticFiles{fsys: staticTestEmbedFS}
+	s.precomputeETags()
+
+	v, ok := s.etags.Load("testdata/static/css/app.css")
+	if !ok {
+		t.Fatal("ETag of embed.FS should be computed before request")
+	}
+
+	r := newRouter()
+	r.Static("/assets", staticTestEmbedFS)
+	w := serveStatic(r, "/assets/testdata/static/css/app.css", nil)
+	if w.data != "body{}" || w.Header().Get("ETag") != v.(tStaticETag).etag {
+		t.Fatal("static error. precomputed ETag should be sent, got:", w.data, w.Header())
+	}
+}